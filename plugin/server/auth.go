@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// apiError is the JSON body returned when an API request is rejected.
+type apiError struct {
+	ID         string `json:"id"`
+	Message    string `json:"message"`
+	StatusCode int    `json:"status_code"`
+}
+
+func writeAPIError(w http.ResponseWriter, statusCode int, id, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(apiError{ID: id, Message: message, StatusCode: statusCode})
+}
+
+// canAccessChannel reports whether the user may read and modify the task list of a channel.
+// Channel members always can; system admins can for any channel and team admins for any
+// channel that belongs to their team.
+func (p *Plugin) canAccessChannel(userID, channelID string) bool {
+	if _, appErr := p.API.GetChannelMember(channelID, userID); appErr == nil {
+		return true
+	}
+
+	if p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		return true
+	}
+
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil || channel == nil || channel.TeamId == "" {
+		return false
+	}
+	return p.API.HasPermissionToTeam(userID, channel.TeamId, model.PermissionManageTeam)
+}
+
+// authorizeChannel checks the authenticated user against the channel and writes a 401 or 403
+// response if they are not allowed to use its task list.
+func (p *Plugin) authorizeChannel(w http.ResponseWriter, r *http.Request, channelID string) (string, bool) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		writeAPIError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return "", false
+	}
+
+	if !p.canAccessChannel(userID, channelID) {
+		p.API.LogWarn("Denied channel task access", "user_id", userID, "channel_id", channelID, "method", r.Method, "path", r.URL.Path)
+		writeAPIError(w, http.StatusForbidden, "channel_access_denied", "You do not have access to the tasks of this channel")
+		return "", false
+	}
+
+	return userID, true
+}
+
+// resolvePrivateUser returns the user whose private task list the request operates on. This is
+// always the authenticated user, unless a system admin explicitly acts on behalf of another user
+// with the on_behalf_of query parameter, in which case the access is written to the audit log.
+func (p *Plugin) resolvePrivateUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		writeAPIError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return "", false
+	}
+	if !p.getConfiguration().EnablePrivateTasks {
+		writeAPIError(w, http.StatusForbidden, "private_tasks_disabled", "Private tasks are disabled on this server")
+		return "", false
+	}
+
+	query := r.URL.Query()
+	if requested := query.Get("user_id"); requested != "" && requested != userID {
+		writeAPIError(w, http.StatusForbidden, "private_access_denied", "user_id must match the authenticated user; system admins can use on_behalf_of")
+		return "", false
+	}
+
+	targetID := query.Get("on_behalf_of")
+	if targetID == "" || targetID == userID {
+		return userID, true
+	}
+
+	if !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		p.API.LogWarn("Denied private task access on behalf of another user", "user_id", userID, "target_user_id", targetID, "method", r.Method, "path", r.URL.Path)
+		writeAPIError(w, http.StatusForbidden, "private_access_denied", "Only system admins can act on behalf of another user")
+		return "", false
+	}
+
+	p.API.LogInfo("Audit: system admin accessed private tasks on behalf of user", "user_id", userID, "target_user_id", targetID, "method", r.Method, "path", r.URL.Path)
+	return targetID, true
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// autocompletePath is the prefix of the endpoints that serve dynamic slash command suggestions.
+// Mattermost calls them with the channel_id and the user of the command.
+const autocompletePath = "/api/v1/autocomplete/"
+
+// autocompleteMaxMembers caps the channel members offered as assignees.
+const autocompleteMaxMembers = 200
+
+// taskFilters are the listing filters accepted by /tasks, in the order they are suggested.
+var taskFilters = []struct {
+	Name string
+	Help string
+}{
+	{"all", "Show all tasks"},
+	{"mine", "Show tasks assigned to me"},
+	{"todo", "Show which tasks to focus on next"},
+	{"today", "Show tasks due today"},
+	{"overdue", "Show tasks due in the past"},
+	{"incomplete", "Show incomplete tasks"},
+	{"complete", "Show completed tasks"},
+}
+
+func isTaskFilter(name string) bool {
+	for _, f := range taskFilters {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// tasksAutocompleteData describes /tasks for the autocomplete menu: the listing filters, the
+// subcommands that change tasks, the private list and the message settings.
+func tasksAutocompleteData() *model.AutocompleteData {
+	tasks := model.NewAutocompleteData("tasks", "[command]", "Show and manage the tasks of this channel")
+	addTaskCommands(tasks, "", true)
+
+	private := model.NewAutocompleteData("private", "[command]", "Show and manage your private tasks")
+	addTaskCommands(private, "private-", false)
+	tasks.AddCommand(private)
+
+	message := model.NewAutocompleteData("message", "[on|off|reset|time|settings]", "Daily task summary settings")
+	message.AddCommand(model.NewAutocompleteData("on", "", "Enable daily task reminders"))
+	message.AddCommand(model.NewAutocompleteData("off", "", "Disable daily task reminders"))
+	message.AddCommand(model.NewAutocompleteData("reset", "", "Send a new summary on your next action"))
+	summaryTime := model.NewAutocompleteData("time", "<time>|off", "Send the summary at a set time in your time zone")
+	summaryTime.AddTextArgument("A time such as 08:30 or 9am, or off to send it on your first activity", "<time>|off", "")
+	message.AddCommand(summaryTime)
+	message.AddCommand(model.NewAutocompleteData("settings", "", "Choose what the daily summary contains"))
+	tasks.AddCommand(message)
+
+	digest := model.NewAutocompleteData("digest", "[weekly|off]", "Weekly task digest posted in this channel")
+	weekly := model.NewAutocompleteData("weekly", "[day] [time]", "Post the digest every week")
+	weekdays := make([]model.AutocompleteListItem, 0, 7)
+	for _, day := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+		weekdays = append(weekdays, model.AutocompleteListItem{Item: strings.ToLower(day.String())})
+	}
+	weekly.AddStaticListArgument("Day of the week, Monday by default", false, weekdays)
+	weekly.AddTextArgument("Time in your time zone, 09:00 by default", "[time]", "")
+	digest.AddCommand(weekly)
+	digest.AddCommand(model.NewAutocompleteData("off", "", "Stop the digest"))
+	tasks.AddCommand(digest)
+
+	notify := model.NewAutocompleteData("notify", "[on|off]", "Assignment message settings")
+	notify.AddCommand(model.NewAutocompleteData("on", "", "Get a message when you are assigned to or unassigned from a task"))
+	notify.AddCommand(model.NewAutocompleteData("off", "", "Stop assignment messages"))
+	reminders := model.NewAutocompleteData("reminders", "[on|off|<offsets>]", "Deadline reminder settings")
+	reminders.AddCommand(model.NewAutocompleteData("on", "", "Get reminders before deadlines and when a task is past due"))
+	reminders.AddCommand(model.NewAutocompleteData("off", "", "Stop deadline reminders"))
+	reminders.AddTextArgument("When to be reminded before a deadline, e.g. 1d 1h", "<offsets>", "")
+	notify.AddCommand(reminders)
+	tasks.AddCommand(notify)
+
+	return tasks
+}
+
+// addTaskCommands adds the filters and task subcommands of one kind of list. prefix selects the
+// autocomplete endpoints of that list.
+func addTaskCommands(parent *model.AutocompleteData, prefix string, withAssignees bool) {
+	for _, f := range taskFilters {
+		if f.Name == "mine" && !withAssignees {
+			continue
+		}
+		parent.AddCommand(model.NewAutocompleteData(f.Name, "", f.Help))
+	}
+
+	// Mattermost only forwards fetch URLs of the form /plugins/{id}/... to a plugin.
+	baseURL := "/plugins/" + pluginID + autocompletePath
+	tasksURL := baseURL + prefix + "tasks"
+	completedURL := baseURL + prefix + "completed-tasks"
+	groupsURL := baseURL + prefix + "groups"
+	membersURL := baseURL + "members"
+
+	add := model.NewAutocompleteData("add", "<text> [@user] [due:<day>] [#group]", "Add a task")
+	add.AddTextArgument("What needs to be done; quote it to use the flags below", "<text>", "")
+	if withAssignees {
+		add.AddNamedDynamicListArgument("assignee", "Assign the task to a channel member", membersURL, false)
+	}
+	add.AddNamedTextArgument("due", "Deadline: a date, today, tomorrow or a weekday", "<day>", "", false)
+	add.AddNamedDynamicListArgument("group", "Put the task in a group", groupsURL, false)
+	parent.AddCommand(add)
+
+	done := model.NewAutocompleteData("done", "<number>", "Complete a task")
+	done.AddDynamicListArgument("Task to complete", tasksURL, true)
+	parent.AddCommand(done)
+
+	reopen := model.NewAutocompleteData("reopen", "<number>", "Reopen a completed task")
+	reopen.AddDynamicListArgument("Task to reopen", completedURL, true)
+	parent.AddCommand(reopen)
+
+	if withAssignees {
+		assign := model.NewAutocompleteData("assign", "<number> @user", "Assign a task to channel members")
+		assign.AddDynamicListArgument("Task to assign", tasksURL, true)
+		assign.AddDynamicListArgument("Channel member", membersURL, true)
+		parent.AddCommand(assign)
+
+		unassign := model.NewAutocompleteData("unassign", "<number> @user", "Remove assignees from a task")
+		unassign.AddDynamicListArgument("Task to unassign", tasksURL, true)
+		unassign.AddDynamicListArgument("Assignee to remove", membersURL, true)
+		parent.AddCommand(unassign)
+	}
+
+	due := model.NewAutocompleteData("due", "<number> <day>", "Set or clear the deadline of a task")
+	due.AddDynamicListArgument("Task to change", tasksURL, true)
+	due.AddTextArgument("A date, today, tomorrow, a weekday, next tuesday, in 3 days or none", "<day>", "")
+	parent.AddCommand(due)
+
+	priority := model.NewAutocompleteData("priority", "<number> <priority>", "Set or clear the priority of a task")
+	priority.AddDynamicListArgument("Task to change", tasksURL, true)
+	priority.AddStaticListArgument("Priority", true, []model.AutocompleteListItem{
+		{Item: "P0", HelpText: "Highest priority"},
+		{Item: "P1", HelpText: "High priority"},
+		{Item: "P2", HelpText: "Normal priority"},
+		{Item: "P3", HelpText: "Low priority"},
+		{Item: "none", HelpText: "Clear the priority"},
+	})
+	parent.AddCommand(priority)
+
+	history := model.NewAutocompleteData("history", "<number>", "Show who changed a task and when")
+	history.AddTextArgument("Number of the task, which may have been deleted", "<number>", "")
+	parent.AddCommand(history)
+}
+
+// handleAutocomplete serves the dynamic argument lists referenced by tasksAutocompleteData.
+func (p *Plugin) handleAutocomplete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Header.Get("Mattermost-User-Id")
+	channelID := r.URL.Query().Get("channel_id")
+	kind := strings.TrimPrefix(r.URL.Path, autocompletePath)
+
+	scope := PrivateScope(userID)
+	if !strings.HasPrefix(kind, "private-") {
+		if channelID == "" {
+			http.Error(w, "channel_id required", http.StatusBadRequest)
+			return
+		}
+		if _, ok := p.authorizeChannel(w, r, channelID); !ok {
+			return
+		}
+		scope = ChannelScope(channelID)
+	}
+
+	var items []model.AutocompleteListItem
+	var err error
+	switch strings.TrimPrefix(kind, "private-") {
+	case "tasks":
+		items, err = p.taskSuggestions(scope, false, p.userNow(userID))
+	case "completed-tasks":
+		items, err = p.taskSuggestions(scope, true, p.userNow(userID))
+	case "groups":
+		items, err = p.groupSuggestions(scope)
+	case "members":
+		items, err = p.memberSuggestions(channelID)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// taskSuggestions offers the numbers of the open (or completed) tasks of a list with their titles.
+// Deadlines are described relative to now.
+func (p *Plugin) taskSuggestions(scope Scope, completed bool, now time.Time) ([]model.AutocompleteListItem, error) {
+	list, err := p.store.GetList(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]TaskItem, 0, len(list.Items))
+	for _, t := range list.Items {
+		if t.Completed == completed && t.Number != 0 {
+			tasks = append(tasks, t)
+		}
+	}
+	sortTasksByDeadline(tasks)
+
+	items := make([]model.AutocompleteListItem, 0, len(tasks))
+	for _, t := range tasks {
+		items = append(items, model.AutocompleteListItem{
+			Item:     strconv.FormatInt(t.Number, 10),
+			Hint:     strings.TrimSpace(p.formatDeadline(t.Deadline, now)),
+			HelpText: t.Text,
+		})
+	}
+	return items, nil
+}
+
+// groupSuggestions offers the group names of a list, quoted when they contain spaces.
+func (p *Plugin) groupSuggestions(scope Scope) ([]model.AutocompleteListItem, error) {
+	list, err := p.store.GetList(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]model.AutocompleteListItem, 0, len(list.Groups))
+	for _, g := range list.Groups {
+		name := g.Name
+		if strings.ContainsAny(name, " \t") {
+			name = fmt.Sprintf("%q", name)
+		}
+		items = append(items, model.AutocompleteListItem{Item: name, HelpText: "Group"})
+	}
+	return items, nil
+}
+
+// memberSuggestions offers the channel members as @mentions.
+func (p *Plugin) memberSuggestions(channelID string) ([]model.AutocompleteListItem, error) {
+	users, appErr := p.API.GetUsersInChannel(channelID, "username", 0, autocompleteMaxMembers)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	items := make([]model.AutocompleteListItem, 0, len(users))
+	for _, user := range users {
+		if user.IsBot || user.DeleteAt != 0 {
+			continue
+		}
+		items = append(items, model.AutocompleteListItem{
+			Item:     "@" + user.Username,
+			HelpText: user.GetDisplayName(model.ShowFullName),
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Item < items[j].Item })
+	return items, nil
+}
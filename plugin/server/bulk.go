@@ -0,0 +1,540 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The operations accepted by the bulk endpoint. delete_completed and delete_group work on the
+// whole list, so clients do not have to send one delete per task.
+const (
+	bulkComplete        = "complete"
+	bulkReopen          = "reopen"
+	bulkDelete          = "delete"
+	bulkMove            = "move"
+	bulkAssign          = "assign"
+	bulkSetDeadline     = "set_deadline"
+	bulkDeleteCompleted = "delete_completed"
+	bulkDeleteGroup     = "delete_group"
+)
+
+// maxBulkOperations limits the size of a bulk request. delete_completed and delete_group count
+// as one operation however many tasks they delete.
+const maxBulkOperations = 500
+
+var errNotApplied = errors.New("not applied because another operation in the request is invalid")
+
+// bulkOperation is one entry of a bulk request. Which fields are used depends on Op: group_id
+// for move (empty moves the task out of its group) and delete_group, assignee_ids for assign
+// (it replaces the assignees) and deadline for set_deadline (null clears it). version makes an
+// operation on a task or group conditional, like If-Match.
+type bulkOperation struct {
+	Op          string     `json:"op"`
+	TaskID      string     `json:"task_id,omitempty"`
+	GroupID     string     `json:"group_id,omitempty"`
+	AssigneeIDs []string   `json:"assignee_ids,omitempty"`
+	Deadline    *time.Time `json:"deadline,omitempty"`
+	Version     int64      `json:"version,omitempty"`
+}
+
+// bulkResult is the outcome of one operation. Task is the stored copy after every operation of
+// the request on that task; DeletedIDs lists the tasks removed by delete_completed and
+// delete_group.
+type bulkResult struct {
+	Index      int       `json:"index"`
+	Op         string    `json:"op"`
+	TaskID     string    `json:"task_id,omitempty"`
+	GroupID    string    `json:"group_id,omitempty"`
+	Status     int       `json:"status"`
+	Task       *TaskItem `json:"task,omitempty"`
+	DeletedIDs []string  `json:"deleted_ids,omitempty"`
+	Error      *apiError `json:"error,omitempty"`
+}
+
+func (r *bulkResult) fail(err error) {
+	r.Task = nil
+	r.Error = bulkError(err)
+	r.Status = r.Error.StatusCode
+}
+
+// bulkError maps a task store error to the error of one bulk result, like writeStoreError.
+func bulkError(err error) *apiError {
+	var stale *staleError
+	var invalid *validationError
+	switch {
+	case errors.As(err, &invalid):
+		return &apiError{ID: "invalid_task", Message: invalid.Error(), StatusCode: http.StatusBadRequest}
+	case errors.As(err, &stale):
+		return &apiError{ID: "stale_version", Message: err.Error(), StatusCode: http.StatusPreconditionFailed}
+	case errors.Is(err, errNotApplied):
+		return &apiError{ID: "not_applied", Message: err.Error(), StatusCode: http.StatusFailedDependency}
+	case errors.Is(err, errTaskListConflict):
+		return &apiError{ID: "task_list_conflict", Message: err.Error(), StatusCode: http.StatusConflict}
+	case errors.Is(err, errTaskNotFound):
+		return &apiError{ID: "task_not_found", Message: "Task not found", StatusCode: http.StatusNotFound}
+	case errors.Is(err, errGroupNotFound):
+		return &apiError{ID: "group_not_found", Message: "Group not found", StatusCode: http.StatusNotFound}
+	default:
+		return &apiError{ID: "internal_error", Message: err.Error(), StatusCode: http.StatusInternalServerError}
+	}
+}
+
+// patch returns the change a task operation makes, validated like a PATCH body.
+func (op bulkOperation) patch(allowAssignees bool) (*taskPatch, error) {
+	patch := &taskPatch{}
+	switch op.Op {
+	case bulkComplete, bulkReopen:
+		completed := op.Op == bulkComplete
+		patch.Completed = &completed
+	case bulkMove:
+		groupID := op.GroupID
+		patch.GroupID = &groupID
+	case bulkAssign:
+		if !allowAssignees {
+			return nil, &validationError{Field: "assignee_ids", Message: "private tasks cannot have assignees"}
+		}
+		ids, err := validateAssigneeIDs(op.AssigneeIDs, allowAssignees)
+		if err != nil {
+			return nil, err
+		}
+		patch.AssigneeIDs = ids
+		patch.SetAssignees = true
+	case bulkSetDeadline:
+		if op.Deadline == nil {
+			patch.ClearDeadline = true
+		} else {
+			patch.Deadline = op.Deadline
+		}
+	default:
+		return nil, &validationError{Field: "op", Message: fmt.Sprintf("%q is not a known operation", op.Op)}
+	}
+	return patch, nil
+}
+
+// bulkPlan is a validated bulk request, ready to be written.
+type bulkPlan struct {
+	// updates holds the indexes of the operations that change each task, with the task IDs in
+	// updateOrder so tasks are written in request order.
+	updates     map[string][]int
+	updateOrder []string
+	patches     []*taskPatch
+	// deletes are the tasks to delete. deleteOwner is the operation that deletes each of them
+	// and deleteChecks what must still hold when it is deleted.
+	deletes      []string
+	deleteOwner  map[string]int
+	deleteChecks map[string]func(task TaskItem) error
+	groups       []int
+}
+
+// planBulk checks every operation against the current list, applying them to a copy in order,
+// so later operations see the effect of earlier ones. It reports false if any operation is
+// invalid, in which case nothing may be written.
+func planBulk(scope Scope, list *ChannelTaskList, ops []bulkOperation) (*bulkPlan, []bulkResult, bool) {
+	tasks := make(map[string]TaskItem, len(list.Items))
+	for _, task := range list.Items {
+		tasks[task.ID] = task
+	}
+	groups := append([]TaskGroup(nil), list.Groups...)
+	deleted := make(map[string]bool)
+
+	plan := &bulkPlan{
+		updates:      make(map[string][]int),
+		patches:      make([]*taskPatch, len(ops)),
+		deleteOwner:  make(map[string]int),
+		deleteChecks: make(map[string]func(task TaskItem) error),
+	}
+	results := make([]bulkResult, len(ops))
+	valid := true
+
+	markDeleted := func(i int, task TaskItem, check func(task TaskItem) error) {
+		deleted[task.ID] = true
+		plan.deletes = append(plan.deletes, task.ID)
+		plan.deleteOwner[task.ID] = i
+		plan.deleteChecks[task.ID] = check
+	}
+
+	for i, op := range ops {
+		result := &results[i]
+		result.Index, result.Op, result.TaskID, result.GroupID = i, op.Op, op.TaskID, op.GroupID
+		result.Status = http.StatusOK
+
+		switch op.Op {
+		case bulkDeleteCompleted:
+			for _, item := range list.Items {
+				task := tasks[item.ID]
+				if deleted[task.ID] || !task.Completed {
+					continue
+				}
+				markDeleted(i, task, func(task TaskItem) error {
+					if !task.Completed {
+						return &validationError{Field: "completed", Message: "task was reopened"}
+					}
+					return nil
+				})
+				result.DeletedIDs = append(result.DeletedIDs, task.ID)
+			}
+			continue
+
+		case bulkDeleteGroup:
+			groupIndex := -1
+			for j, g := range groups {
+				if g.ID == op.GroupID {
+					groupIndex = j
+				}
+			}
+			if groupIndex < 0 {
+				result.fail(errGroupNotFound)
+				valid = false
+				continue
+			}
+			group := groups[groupIndex]
+			if err := checkVersion(op.Version > 0, op.Version, group.Version, group); err != nil {
+				result.fail(err)
+				valid = false
+				continue
+			}
+			groupID := group.ID
+			for _, item := range list.Items {
+				task := tasks[item.ID]
+				if deleted[task.ID] || task.GroupID != groupID {
+					continue
+				}
+				markDeleted(i, task, func(task TaskItem) error {
+					if task.GroupID != groupID {
+						return &validationError{Field: "group_id", Message: "task was moved to another group"}
+					}
+					return nil
+				})
+				result.DeletedIDs = append(result.DeletedIDs, task.ID)
+			}
+			groups = append(groups[:groupIndex], groups[groupIndex+1:]...)
+			plan.groups = append(plan.groups, i)
+			continue
+		}
+
+		var patch *taskPatch
+		if op.Op != bulkDelete {
+			var err error
+			if patch, err = op.patch(scope.AllowsAssignees()); err != nil {
+				result.fail(err)
+				valid = false
+				continue
+			}
+		}
+
+		task, ok := tasks[op.TaskID]
+		if !ok || deleted[op.TaskID] {
+			result.fail(errTaskNotFound)
+			valid = false
+			continue
+		}
+		if err := checkVersion(op.Version > 0, op.Version, task.Version, task); err != nil {
+			result.fail(err)
+			valid = false
+			continue
+		}
+
+		if op.Op == bulkDelete {
+			// A task changed earlier in the request is written once before it is deleted.
+			expected := op.Version
+			if _, updated := plan.updates[task.ID]; updated && expected > 0 {
+				expected++
+			}
+			markDeleted(i, task, func(task TaskItem) error {
+				return checkVersion(expected > 0, expected, task.Version, task)
+			})
+			continue
+		}
+
+		if err := patch.apply(&task, groups); err != nil {
+			result.fail(err)
+			valid = false
+			continue
+		}
+		tasks[task.ID] = task
+		plan.patches[i] = patch
+		if _, ok := plan.updates[task.ID]; !ok {
+			plan.updateOrder = append(plan.updateOrder, task.ID)
+		}
+		plan.updates[task.ID] = append(plan.updates[task.ID], i)
+	}
+
+	if !valid {
+		markNotApplied(results)
+	}
+	return plan, results, valid
+}
+
+// markNotApplied fails every result that has not failed already with errNotApplied, once the
+// request as a whole has been rejected.
+func markNotApplied(results []bulkResult) {
+	for i := range results {
+		if results[i].Error == nil {
+			results[i].DeletedIDs = nil
+			results[i].fail(errNotApplied)
+		}
+	}
+}
+
+// checkBulkAssignees checks that the users added by assign operations are members of the
+// channel, as checkNewAssignees does for PUT and PATCH. planBulk does not call the API, so this
+// runs on its plan before anything is written. It reports false if a user is not a member.
+func (p *Plugin) checkBulkAssignees(scope Scope, list *ChannelTaskList, ops []bulkOperation, plan *bulkPlan, results []bulkResult) bool {
+	assigned := make(map[string][]string, len(list.Items))
+	for _, task := range list.Items {
+		assigned[task.ID] = task.AssigneeIDs
+	}
+
+	valid := true
+	for i, op := range ops {
+		if op.Op != bulkAssign || plan.patches[i] == nil {
+			continue
+		}
+		if err := p.checkNewAssignees(scope, assigned[op.TaskID], plan.patches[i].AssigneeIDs); err != nil {
+			results[i].fail(err)
+			valid = false
+		}
+	}
+	if !valid {
+		markNotApplied(results)
+	}
+	return valid
+}
+
+// handleBulkTasks serves the bulk endpoint of a channel list.
+func (p *Plugin) handleBulkTasks(w http.ResponseWriter, r *http.Request) {
+	channelID := r.URL.Query().Get("channel_id")
+	if channelID == "" {
+		http.Error(w, "channel_id required", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := p.authorizeChannel(w, r, channelID); !ok {
+		return
+	}
+
+	p.serveBulkTasks(w, r, ChannelScope(channelID))
+}
+
+// handlePrivateBulkTasks serves the bulk endpoint of a private list.
+func (p *Plugin) handlePrivateBulkTasks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := p.resolvePrivateUser(w, r)
+	if !ok {
+		return
+	}
+
+	p.serveBulkTasks(w, r, PrivateScope(userID))
+}
+
+// serveBulkTasks applies a list of operations to the tasks of a list. All operations are
+// validated before anything is written, and nothing is written if one of them is invalid. Each
+// task is then written once with all of its changes, and the deletes share one write of the
+// trash index and one of the list index. The writes are not atomic: if one still fails, for
+// example because the list changed while the request was applied, the writes already made are
+// reverted by further writes; see applyBulk.
+func (p *Plugin) serveBulkTasks(w http.ResponseWriter, r *http.Request, scope Scope) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		Operations []bulkOperation `json:"operations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_bulk_request", "The body must be a JSON object with an operations array")
+		return
+	}
+	if len(request.Operations) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "invalid_bulk_request", "operations must not be empty")
+		return
+	}
+	if len(request.Operations) > maxBulkOperations {
+		writeAPIError(w, http.StatusBadRequest, "invalid_bulk_request", fmt.Sprintf("At most %d operations can be sent at once", maxBulkOperations))
+		return
+	}
+
+	list, err := p.store.GetList(scope)
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
+	}
+
+	plan, results, valid := planBulk(scope, list, request.Operations)
+	valid = valid && p.checkBulkAssignees(scope, list, request.Operations, plan, results)
+	applied := valid && p.applyBulk(r.Header.Get("Mattermost-User-Id"), scope, request.Operations, plan, results)
+
+	status := http.StatusOK
+	if !valid {
+		status = http.StatusBadRequest
+	} else if !applied {
+		// The operation whose write failed decides the status, e.g. 412 for a stale version.
+		for _, result := range results {
+			if result.Error != nil && result.Status != http.StatusFailedDependency {
+				status = result.Status
+				break
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Applied bool         `json:"applied"`
+		Results []bulkResult `json:"results"`
+	}{applied, results})
+}
+
+// appliedUpdate is a task written by a bulk request, kept so the write can be undone.
+type appliedUpdate struct {
+	previous TaskItem
+	result   *TaskItem
+	steps    []int
+}
+
+// applyBulk writes a validated plan: first the task changes, then the deletes, then the deleted
+// groups. It stops at the first write that fails, undoes the writes made before it with
+// undoBulk, marks the result of the failed operation and every other one as not applied and
+// returns false. Events, messages and history are only sent once every write has succeeded.
+//
+// This is compensation, not a transaction. Until undoBulk has run, other requests can read the
+// writes already made, and a server that stops part way through leaves them in place.
+func (p *Plugin) applyBulk(userID string, scope Scope, ops []bulkOperation, plan *bulkPlan, results []bulkResult) bool {
+	var updated []appliedUpdate
+	var deleted []TaskItem
+	var deletedGroups []TaskGroup
+	failed := false
+
+	for _, taskID := range plan.updateOrder {
+		steps := plan.updates[taskID]
+		var previous TaskItem
+		result, err := p.store.UpdateTask(scope, taskID, func(task *TaskItem, groups []TaskGroup) error {
+			previous = *task
+			for _, i := range steps {
+				if err := checkVersion(ops[i].Version > 0, ops[i].Version, previous.Version, previous); err != nil {
+					return err
+				}
+				if err := plan.patches[i].apply(task, groups); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			for _, i := range steps {
+				results[i].fail(err)
+			}
+			failed = true
+			break
+		}
+		updated = append(updated, appliedUpdate{previous: previous, result: result, steps: steps})
+	}
+
+	if !failed && len(plan.deletes) > 0 {
+		var failedDeletes map[string]error
+		var err error
+		deleted, failedDeletes, err = p.store.DeleteTasks(scope, plan.deletes, func(task TaskItem) error {
+			return plan.deleteChecks[task.ID](task)
+		})
+		if err != nil {
+			failedDeletes = make(map[string]error)
+			for _, taskID := range plan.deletes {
+				failedDeletes[taskID] = err
+			}
+		}
+		for taskID, err := range failedDeletes {
+			results[plan.deleteOwner[taskID]].fail(err)
+			failed = true
+		}
+	}
+
+	if !failed {
+		for _, i := range plan.groups {
+			op := ops[i]
+			var deletedGroup TaskGroup
+			if err := p.store.DeleteGroup(scope, op.GroupID, func(group TaskGroup) error {
+				deletedGroup = group
+				return checkVersion(op.Version > 0, op.Version, group.Version, group)
+			}); err != nil {
+				results[i].fail(err)
+				failed = true
+				break
+			}
+			deletedGroups = append(deletedGroups, deletedGroup)
+		}
+	}
+
+	if failed {
+		p.undoBulk(scope, updated, deleted, deletedGroups)
+		markNotApplied(results)
+		return false
+	}
+
+	for _, u := range updated {
+		for _, i := range u.steps {
+			results[i].Task = u.result
+		}
+		p.notifyAssignmentChanges(userID, scope, u.previous.AssigneeIDs, u.result)
+		p.publishTaskEvent(scope, eventTaskUpdated, u.result)
+		p.recordTaskHistory(userID, scope, &u.previous, u.result)
+	}
+	for i := range deleted {
+		p.publishTaskEvent(scope, eventTaskDeleted, &deleted[i])
+		p.recordTaskHistory(userID, scope, &deleted[i], nil)
+	}
+	for i := range deletedGroups {
+		p.publishGroupEvent(scope, eventGroupDeleted, &deletedGroups[i])
+	}
+	return true
+}
+
+// undoBulk reverts the writes of a bulk request that could not be applied in full, newest first:
+// deleted groups and tasks are restored from the trash and updated tasks get their previous copy
+// back. A task that someone else changed in the meantime keeps their change. Versions only move
+// forward, so clients are sent the restored copies.
+func (p *Plugin) undoBulk(scope Scope, updated []appliedUpdate, deleted []TaskItem, groups []TaskGroup) {
+	for i := len(groups) - 1; i >= 0; i-- {
+		group, err := p.store.RestoreGroup(scope, groups[i].ID)
+		if err != nil {
+			p.API.LogError("Failed to undo the delete of a group in a bulk request", "group_id", groups[i].ID, "error", err.Error())
+			continue
+		}
+		p.publishGroupEvent(scope, eventGroupUpdated, group)
+	}
+
+	restored := make(map[string]*TaskItem)
+	for _, task := range deleted {
+		back, _, err := p.store.RestoreTask(scope, task.ID)
+		if err != nil {
+			p.API.LogError("Failed to undo the delete of a task in a bulk request", "task_id", task.ID, "error", err.Error())
+			continue
+		}
+		restored[task.ID] = back
+	}
+
+	for i := len(updated) - 1; i >= 0; i-- {
+		u := updated[i]
+		written := u.result.Version
+		if back, ok := restored[u.result.ID]; ok {
+			written = back.Version
+		}
+		back, err := p.store.UpdateTask(scope, u.result.ID, func(task *TaskItem, _ []TaskGroup) error {
+			if err := checkVersion(true, written, task.Version, *task); err != nil {
+				return err
+			}
+			*task = u.previous
+			return nil
+		})
+		if err != nil {
+			p.API.LogError("Failed to undo a task change in a bulk request", "task_id", u.result.ID, "error", err.Error())
+			continue
+		}
+		restored[u.result.ID] = back
+	}
+
+	for _, task := range restored {
+		p.publishTaskEvent(scope, eventTaskUpdated, task)
+	}
+}
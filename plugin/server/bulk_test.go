@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanBulk(t *testing.T) {
+	userID := "aaaaaaaaaaaaaaaaaaaaaaaaaa"
+	list := func() *ChannelTaskList {
+		return &ChannelTaskList{
+			Items: []TaskItem{
+				{ID: "t1", Text: "one", GroupID: "g1", Version: 1},
+				{ID: "t2", Text: "two", Completed: true, Version: 2},
+				{ID: "t3", Text: "three", GroupID: "g1", Version: 1},
+			},
+			Groups: []TaskGroup{{ID: "g1", Name: "Release", Version: 1}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		private bool
+		ops     []bulkOperation
+		// wantStatus holds the status of each result.
+		wantStatus      []int
+		wantValid       bool
+		wantUpdateOrder []string
+		wantUpdates     map[string][]int
+		wantDeletes     []string
+		wantGroups      []int
+	}{
+		{
+			name: "changes to a task are written together in request order",
+			ops: []bulkOperation{
+				{Op: bulkComplete, TaskID: "t3"},
+				{Op: bulkMove, TaskID: "t1"},
+				{Op: bulkSetDeadline, TaskID: "t3"},
+			},
+			wantStatus:      []int{200, 200, 200},
+			wantValid:       true,
+			wantUpdateOrder: []string{"t3", "t1"},
+			wantUpdates:     map[string][]int{"t3": {0, 2}, "t1": {1}},
+		},
+		{
+			name: "delete_completed sees tasks completed earlier in the request",
+			ops: []bulkOperation{
+				{Op: bulkComplete, TaskID: "t1"},
+				{Op: bulkDeleteCompleted},
+			},
+			wantStatus:      []int{200, 200},
+			wantValid:       true,
+			wantUpdateOrder: []string{"t1"},
+			wantUpdates:     map[string][]int{"t1": {0}},
+			wantDeletes:     []string{"t1", "t2"},
+		},
+		{
+			name:        "delete_group deletes the tasks of the group",
+			ops:         []bulkOperation{{Op: bulkDeleteGroup, GroupID: "g1", Version: 1}},
+			wantStatus:  []int{200},
+			wantValid:   true,
+			wantUpdates: map[string][]int{},
+			wantDeletes: []string{"t1", "t3"},
+			wantGroups:  []int{0},
+		},
+		{
+			name: "assign on a channel list",
+			ops: []bulkOperation{
+				{Op: bulkAssign, TaskID: "t1", AssigneeIDs: []string{userID, userID}},
+			},
+			wantStatus:      []int{200},
+			wantValid:       true,
+			wantUpdateOrder: []string{"t1"},
+			wantUpdates:     map[string][]int{"t1": {0}},
+		},
+		{
+			name: "a task deleted earlier in the request cannot be changed",
+			ops: []bulkOperation{
+				{Op: bulkDelete, TaskID: "t2"},
+				{Op: bulkReopen, TaskID: "t2"},
+			},
+			wantStatus: []int{http.StatusFailedDependency, http.StatusNotFound},
+		},
+		{
+			name: "a stale version rejects the request",
+			ops: []bulkOperation{
+				{Op: bulkReopen, TaskID: "t2", Version: 2},
+				{Op: bulkComplete, TaskID: "t1", Version: 2},
+			},
+			wantStatus: []int{http.StatusFailedDependency, http.StatusPreconditionFailed},
+		},
+		{
+			name: "a group deleted earlier in the request cannot be used",
+			ops: []bulkOperation{
+				{Op: bulkDeleteGroup, GroupID: "g1"},
+				{Op: bulkMove, TaskID: "t2", GroupID: "g1"},
+			},
+			wantStatus: []int{http.StatusFailedDependency, http.StatusBadRequest},
+		},
+		{
+			name:       "unknown group",
+			ops:        []bulkOperation{{Op: bulkDeleteGroup, GroupID: "g2"}},
+			wantStatus: []int{http.StatusNotFound},
+		},
+		{
+			name:       "unknown task",
+			ops:        []bulkOperation{{Op: bulkComplete, TaskID: "t9"}},
+			wantStatus: []int{http.StatusNotFound},
+		},
+		{
+			name:       "unknown operation",
+			ops:        []bulkOperation{{Op: "archive", TaskID: "t1"}},
+			wantStatus: []int{http.StatusBadRequest},
+		},
+		{
+			name:       "invalid assignee",
+			ops:        []bulkOperation{{Op: bulkAssign, TaskID: "t1", AssigneeIDs: []string{"nope"}}},
+			wantStatus: []int{http.StatusBadRequest},
+		},
+		{
+			name:       "assign on a private list",
+			private:    true,
+			ops:        []bulkOperation{{Op: bulkAssign, TaskID: "t1", AssigneeIDs: []string{userID}}},
+			wantStatus: []int{http.StatusBadRequest},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope := ChannelScope("channel")
+			if tt.private {
+				scope = PrivateScope(userID)
+			}
+
+			plan, results, valid := planBulk(scope, list(), tt.ops)
+			require.Len(t, results, len(tt.ops))
+			assert.Equal(t, tt.wantValid, valid)
+			for i, result := range results {
+				assert.Equal(t, i, result.Index)
+				assert.Equal(t, tt.wantStatus[i], result.Status, "status of operation %d", i)
+			}
+			if !valid {
+				for _, result := range results {
+					assert.Nil(t, result.DeletedIDs)
+				}
+				return
+			}
+
+			assert.Equal(t, tt.wantUpdateOrder, plan.updateOrder)
+			assert.Equal(t, tt.wantUpdates, plan.updates)
+			assert.Equal(t, tt.wantDeletes, plan.deletes)
+			assert.Equal(t, tt.wantGroups, plan.groups)
+			for _, taskID := range plan.deletes {
+				assert.Contains(t, results[plan.deleteOwner[taskID]].DeletedIDs, taskID)
+			}
+		})
+	}
+}
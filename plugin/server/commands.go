@@ -0,0 +1,525 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// taskInput is a task described inline in a slash command, e.g.
+// `Ship release notes @alice @bob due:friday #Release`.
+type taskInput struct {
+	Text      string
+	Usernames []string
+	Deadline  *time.Time
+	GroupName string
+}
+
+// parseTaskInput splits slash command words into the task text and its attributes: @mentions
+// are assignees, due:<day> sets the deadline and #Name picks a group. The autocomplete flags
+// --assignee, --due and --group do the same and take a value that may be quoted. Everything else
+// is text.
+func parseTaskInput(words []string, now time.Time) (*taskInput, error) {
+	input := &taskInput{}
+	var text []string
+
+	setDeadline := func(value string) error {
+		day, ok := parseDay(value, now)
+		if !ok {
+			return fmt.Errorf("I don't understand the date `%s`. Try `2026-11-01`, `tomorrow` or `friday`", value)
+		}
+		deadline := deadlineForDay(day)
+		input.Deadline = &deadline
+		return nil
+	}
+
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		switch {
+		case word == "--assignee" || word == "--due" || word == "--group":
+			value, next := quotedValue(words, i+1)
+			if value == "" {
+				return nil, fmt.Errorf("`%s` needs a value", word)
+			}
+			i = next - 1
+			switch word {
+			case "--assignee":
+				input.Usernames = append(input.Usernames, strings.TrimPrefix(value, "@"))
+			case "--due":
+				if err := setDeadline(value); err != nil {
+					return nil, err
+				}
+			case "--group":
+				input.GroupName = value
+			}
+		case strings.HasPrefix(word, "@") && len(word) > 1:
+			input.Usernames = append(input.Usernames, strings.TrimRight(word[1:], ".,;:!?"))
+		case strings.HasPrefix(strings.ToLower(word), "due:"):
+			if err := setDeadline(word[len("due:"):]); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(word, "#") && len(word) > 1:
+			input.GroupName = word[1:]
+		default:
+			text = append(text, word)
+		}
+	}
+
+	input.Text = strings.Join(text, " ")
+	if len(input.Text) > 1 && strings.HasPrefix(input.Text, `"`) && strings.HasSuffix(input.Text, `"`) {
+		input.Text = input.Text[1 : len(input.Text)-1]
+	}
+	if strings.TrimSpace(input.Text) == "" {
+		return nil, fmt.Errorf("Please describe the task, e.g. `/tasks add Ship release notes @alice due:friday #Release`")
+	}
+	return input, nil
+}
+
+// quotedValue returns the value starting at words[start], joining words up to the closing quote
+// when it starts with a double quote, and the index of the first word after it.
+func quotedValue(words []string, start int) (string, int) {
+	if start >= len(words) {
+		return "", start
+	}
+	if !strings.HasPrefix(words[start], `"`) {
+		return words[start], start + 1
+	}
+
+	for end := start; end < len(words); end++ {
+		if (end > start || len(words[start]) > 1) && strings.HasSuffix(words[end], `"`) {
+			return strings.Trim(strings.Join(words[start:end+1], " "), `"`), end + 1
+		}
+	}
+	return strings.Trim(strings.Join(words[start:], " "), `"`), len(words)
+}
+
+// deadlineForDay stores a deadline the way the sidebar's date picker does: midnight UTC of the
+// chosen calendar day.
+func deadlineForDay(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// lookupUsers resolves usernames to users, dropping duplicates.
+func (p *Plugin) lookupUsers(usernames []string) ([]*model.User, error) {
+	var users []*model.User
+	seen := make(map[string]bool)
+	for _, username := range usernames {
+		user, appErr := p.API.GetUserByUsername(username)
+		if appErr != nil {
+			return nil, fmt.Errorf("I couldn't find a user called @%s.", username)
+		}
+		if !seen[user.Id] {
+			seen[user.Id] = true
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// resolveAssignees looks up the mentioned users and checks that they can see the channel.
+func (p *Plugin) resolveAssignees(usernames []string, scope Scope) ([]string, error) {
+	users, err := p.lookupUsers(usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(users))
+	for _, user := range users {
+		if _, appErr := p.API.GetChannelMember(scope.ID, user.Id); appErr != nil {
+			return nil, fmt.Errorf("@%s is not a member of this channel.", user.Username)
+		}
+		ids = append(ids, user.Id)
+	}
+	return ids, nil
+}
+
+// findGroupByName returns the group with the given name, ignoring case.
+func findGroupByName(groups []TaskGroup, name string) (TaskGroup, bool) {
+	for _, g := range groups {
+		if strings.EqualFold(g.Name, name) {
+			return g, true
+		}
+	}
+	return TaskGroup{}, false
+}
+
+// taskCommandAliases maps the triggers that predate the single /tasks command to the words they
+// stand for, so /tasks-private-today behaves like /tasks private today.
+var taskCommandAliases = map[string][]string{
+	"tasks":                    {},
+	"t":                        {},
+	"tasks-mine":               {"mine"},
+	"tmine":                    {"mine"},
+	"tasks-overdue":            {"overdue"},
+	"tasks-today":              {"today"},
+	"tasks-incomplete":         {"incomplete"},
+	"tasks-complete":           {"complete"},
+	"tasks-todo":               {"todo"},
+	"ttodo":                    {"todo"},
+	"tasks-private":            {"private"},
+	"tp":                       {"private"},
+	"tasks-private-overdue":    {"private", "overdue"},
+	"tasks-private-today":      {"private", "today"},
+	"tasks-private-incomplete": {"private", "incomplete"},
+	"tasks-private-complete":   {"private", "complete"},
+	"tasks-private-todo":       {"private", "todo"},
+	"tptodo":                   {"private", "todo"},
+	"tasks-message-on":         {"message", "on"},
+	"tasks-message-off":        {"message", "off"},
+	"tasks-message-reset":      {"message", "reset"},
+	"tasks-message-settings":   {"message", "settings"},
+	"tasks-message":            {"message"},
+}
+
+// runTasksCommand handles /tasks and its aliases once the alias has been expanded into words.
+func (p *Plugin) runTasksCommand(args *model.CommandArgs, words []string) (*model.CommandResponse, *model.AppError) {
+	scope := ChannelScope(args.ChannelId)
+	if len(words) > 0 && words[0] == "private" {
+		if !p.getConfiguration().EnablePrivateTasks {
+			return ephemeralResponse("🔒 Private tasks are disabled on this server."), nil
+		}
+		scope = PrivateScope(args.UserId)
+		words = words[1:]
+	}
+
+	if len(words) == 0 {
+		return p.handleTasksCommand(args, scope, "all")
+	}
+
+	if words[0] == "message" && !scope.IsPrivate() {
+		setting := ""
+		if len(words) > 1 {
+			setting = words[1]
+		}
+		switch setting {
+		case "on":
+			return p.handleDailyTasksOn(args)
+		case "off":
+			return p.handleDailyTasksOff(args)
+		case "reset":
+			return p.handleDailyTasksReset(args)
+		case "time":
+			return p.handleDailySummaryTime(args, words[2:]), nil
+		case "settings":
+			return p.openSummarySettings(args), nil
+		}
+		return ephemeralResponse("❌ Usage: `/tasks message on`, `/tasks message off`, `/tasks message reset`, `/tasks message time <time>` or `/tasks message settings`"), nil
+	}
+
+	if words[0] == "digest" && !scope.IsPrivate() {
+		return p.handleDigestCommand(args, words[1:]), nil
+	}
+
+	if words[0] == "notify" && !scope.IsPrivate() {
+		return p.handleNotifyCommand(args, words[1:]), nil
+	}
+
+	if resp, handled := p.handleTaskSubcommand(args, scope, words[0], words[1:]); handled {
+		return resp, nil
+	}
+	if isTaskFilter(words[0]) {
+		return p.handleTasksCommand(args, scope, words[0])
+	}
+	return ephemeralResponse(tasksCommandHelp), nil
+}
+
+const tasksCommandHelp = `#### /tasks
+- ` + "`/tasks [all|mine|todo|today|overdue|incomplete|complete]`" + ` shows the tasks of this channel
+- ` + "`/tasks add <text> @user due:<day> #group`" + ` adds a task
+- ` + "`/tasks done|reopen <number>`" + ` completes or reopens a task
+- ` + "`/tasks assign|unassign <number> @user`" + ` changes who a task is assigned to
+- ` + "`/tasks due <number> <day>|none`" + ` sets or clears a deadline
+- ` + "`/tasks priority <number> P0|P1|P2|P3|none`" + ` sets or clears the priority of a task
+- ` + "`/tasks history <number>`" + ` shows who changed a task and when, even after it was deleted
+- ` + "`/tasks private ...`" + ` does the same for your private tasks
+- ` + "`/tasks message on|off|reset`" + ` controls the daily task summary
+- ` + "`/tasks message time 08:30|off`" + ` sends the summary at a set time in your time zone
+- ` + "`/tasks notify on|off`" + ` controls messages when you are assigned to or unassigned from a task
+- ` + "`/tasks notify reminders on|off|1d 1h`" + ` controls deadline reminders`
+
+// handleTaskSubcommand runs `/tasks <subcommand> ...` and `/tasks-private <subcommand> ...`.
+// handled is false when the word after the trigger is not a subcommand, so the caller can treat
+// the command as a listing.
+func (p *Plugin) handleTaskSubcommand(args *model.CommandArgs, scope Scope, subcommand string, words []string) (resp *model.CommandResponse, handled bool) {
+	switch subcommand {
+	case "add":
+		return p.handleAddTaskCommand(args, scope, words), true
+	case "done", "reopen", "assign", "unassign", "due", "priority":
+		return p.handleTaskMutationCommand(args, scope, subcommand, words), true
+	case "history":
+		return p.handleHistoryCommand(args, scope, words), true
+	}
+	return nil, false
+}
+
+// handleAddTaskCommand creates a task from `/tasks add ...` or `/tasks-private add ...`.
+func (p *Plugin) handleAddTaskCommand(args *model.CommandArgs, scope Scope, words []string) *model.CommandResponse {
+	now := p.userNow(args.UserId)
+	input, err := parseTaskInput(words, now)
+	if err != nil {
+		return ephemeralResponse("❌ " + err.Error())
+	}
+
+	task := TaskItem{Text: input.Text, Deadline: input.Deadline, CreatedBy: args.UserId}
+
+	if len(input.Usernames) > 0 {
+		if !scope.AllowsAssignees() {
+			return ephemeralResponse("❌ Private tasks cannot be assigned to anyone.")
+		}
+		if task.AssigneeIDs, err = p.resolveAssignees(input.Usernames, scope); err != nil {
+			return ephemeralResponse("❌ " + err.Error())
+		}
+	}
+
+	groupName := ""
+	if input.GroupName != "" {
+		list, err := p.store.GetList(scope)
+		if err != nil {
+			p.API.LogError("Failed to load task list", "scope", string(scope.Kind), "id", scope.ID, "error", err.Error())
+			return ephemeralResponse("❌ Error loading tasks.")
+		}
+		group, ok := findGroupByName(list.Groups, input.GroupName)
+		if !ok {
+			names := make([]string, 0, len(list.Groups))
+			for _, g := range list.Groups {
+				names = append(names, "#"+g.Name)
+			}
+			if len(names) == 0 {
+				return ephemeralResponse(fmt.Sprintf("❌ There is no group called **%s**, and no groups exist yet. Create one in the task sidebar.", input.GroupName))
+			}
+			return ephemeralResponse(fmt.Sprintf("❌ There is no group called **%s**. Available groups: %s", input.GroupName, strings.Join(names, ", ")))
+		}
+		task.GroupID = group.ID
+		groupName = group.Name
+	}
+
+	created, err := p.store.CreateTask(scope, task)
+	if err != nil {
+		p.API.LogError("Failed to create task from slash command", "scope", string(scope.Kind), "id", scope.ID, "error", err.Error())
+		return ephemeralResponse("❌ Error saving the task. Please try again.")
+	}
+	p.notifyAssignmentChanges(args.UserId, scope, nil, created)
+	p.publishTaskEvent(scope, eventTaskCreated, created)
+	p.recordTaskHistory(args.UserId, scope, nil, created)
+
+	var sb strings.Builder
+	if scope.IsPrivate() {
+		sb.WriteString(fmt.Sprintf("✅ Added private task #%d **%s**", created.Number, created.Text))
+	} else {
+		sb.WriteString(fmt.Sprintf("✅ Added #%d **%s**", created.Number, created.Text))
+	}
+	if groupName != "" {
+		sb.WriteString(fmt.Sprintf(" | **%s**", groupName))
+	}
+	if created.Deadline != nil {
+		sb.WriteString(" |" + p.formatDeadline(created.Deadline, now))
+	}
+	if len(input.Usernames) > 0 {
+		mentions := make([]string, 0, len(input.Usernames))
+		for _, username := range input.Usernames {
+			mentions = append(mentions, "@"+username)
+		}
+		sb.WriteString(" | assigned to " + strings.Join(mentions, ", "))
+	}
+
+	return ephemeralResponse(sb.String())
+}
+
+// parseTaskNumber accepts a task number written as "14" or "#14".
+func parseTaskNumber(word string) (int64, bool) {
+	number, err := strconv.ParseInt(strings.TrimPrefix(word, "#"), 10, 64)
+	if err != nil || number <= 0 {
+		return 0, false
+	}
+	return number, true
+}
+
+// findTaskByNumber returns the task of the list that has the given number.
+func (p *Plugin) findTaskByNumber(scope Scope, number int64) (*TaskItem, error) {
+	list, err := p.store.GetList(scope)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		if list.Items[i].Number == number {
+			return &list.Items[i], nil
+		}
+	}
+	return nil, errTaskNotFound
+}
+
+// handleTaskMutationCommand runs `/tasks done|reopen|assign|unassign|due|priority <number> ...`.
+// Changes go through the task store like an update from the sidebar, so versions and CompletedAt
+// are maintained the same way.
+func (p *Plugin) handleTaskMutationCommand(args *model.CommandArgs, scope Scope, subcommand string, words []string) *model.CommandResponse {
+	usage := map[string]string{
+		"done":     "`/tasks done <number>`",
+		"reopen":   "`/tasks reopen <number>`",
+		"assign":   "`/tasks assign <number> @user`",
+		"unassign": "`/tasks unassign <number> @user`",
+		"due":      "`/tasks due <number> <day>` or `/tasks due <number> none`",
+		"priority": "`/tasks priority <number> P0|P1|P2|P3` or `/tasks priority <number> none`",
+	}[subcommand]
+
+	if len(words) == 0 {
+		return ephemeralResponse("❌ Usage: " + usage)
+	}
+	number, ok := parseTaskNumber(words[0])
+	if !ok {
+		return ephemeralResponse(fmt.Sprintf("❌ `%s` is not a task number. Usage: %s", words[0], usage))
+	}
+	rest := words[1:]
+
+	location := "in this channel"
+	if scope.IsPrivate() {
+		location = "in your private tasks"
+	}
+
+	task, err := p.findTaskByNumber(scope, number)
+	if errors.Is(err, errTaskNotFound) {
+		return ephemeralResponse(fmt.Sprintf("❌ There is no task #%d %s.", number, location))
+	}
+	if err != nil {
+		p.API.LogError("Failed to load task list", "scope", string(scope.Kind), "id", scope.ID, "error", err.Error())
+		return ephemeralResponse("❌ Error loading tasks.")
+	}
+
+	var change func(task *TaskItem)
+	var confirmation string
+
+	switch subcommand {
+	case "done", "reopen":
+		completed := subcommand == "done"
+		change = func(task *TaskItem) {
+			task.Completed = completed
+		}
+		confirmation = fmt.Sprintf("✅ Completed #%d **%s**", number, task.Text)
+		if !completed {
+			confirmation = fmt.Sprintf("↩️ Reopened #%d **%s**", number, task.Text)
+		}
+
+	case "assign", "unassign":
+		if !scope.AllowsAssignees() {
+			return ephemeralResponse("❌ Private tasks cannot be assigned to anyone.")
+		}
+		var usernames []string
+		for _, word := range rest {
+			usernames = append(usernames, strings.TrimRight(strings.TrimPrefix(word, "@"), ".,;:!?"))
+		}
+		if len(usernames) == 0 {
+			return ephemeralResponse("❌ Usage: " + usage)
+		}
+
+		var userIDs []string
+		if subcommand == "assign" {
+			if userIDs, err = p.resolveAssignees(usernames, scope); err != nil {
+				return ephemeralResponse("❌ " + err.Error())
+			}
+		} else {
+			users, err := p.lookupUsers(usernames)
+			if err != nil {
+				return ephemeralResponse("❌ " + err.Error())
+			}
+			for _, user := range users {
+				userIDs = append(userIDs, user.Id)
+			}
+		}
+
+		mentions := make([]string, 0, len(usernames))
+		for _, username := range usernames {
+			mentions = append(mentions, "@"+username)
+		}
+
+		if subcommand == "assign" {
+			change = func(task *TaskItem) {
+				for _, id := range userIDs {
+					if !isAssignedTo(*task, id) {
+						task.AssigneeIDs = append(task.AssigneeIDs, id)
+					}
+				}
+			}
+			confirmation = fmt.Sprintf("👤 Assigned #%d **%s** to %s", number, task.Text, strings.Join(mentions, ", "))
+		} else {
+			change = func(task *TaskItem) {
+				remaining := []string{}
+				for _, assigneeID := range task.AssigneeIDs {
+					removed := false
+					for _, id := range userIDs {
+						if assigneeID == id {
+							removed = true
+							break
+						}
+					}
+					if !removed {
+						remaining = append(remaining, assigneeID)
+					}
+				}
+				task.AssigneeIDs = remaining
+			}
+			confirmation = fmt.Sprintf("👤 Unassigned %s from #%d **%s**", strings.Join(mentions, ", "), number, task.Text)
+		}
+
+	case "due":
+		value := strings.Join(rest, " ")
+		if value == "" {
+			return ephemeralResponse("❌ Usage: " + usage)
+		}
+		if strings.EqualFold(value, "none") || strings.EqualFold(value, "clear") {
+			change = func(task *TaskItem) {
+				task.Deadline = nil
+			}
+			confirmation = fmt.Sprintf("📅 #%d **%s** no longer has a deadline", number, task.Text)
+			break
+		}
+		now := p.userNow(args.UserId)
+		day, ok := parseDay(value, now)
+		if !ok {
+			return ephemeralResponse(fmt.Sprintf("❌ I don't understand the date `%s`. Try `2026-11-01`, `tomorrow`, `friday` or `next tuesday`.", value))
+		}
+		deadline := deadlineForDay(day)
+		change = func(task *TaskItem) {
+			task.Deadline = &deadline
+		}
+		confirmation = fmt.Sprintf("📅 #%d **%s** is now%s", number, task.Text, p.formatDeadline(&deadline, now))
+
+	case "priority":
+		if len(rest) != 1 {
+			return ephemeralResponse("❌ Usage: " + usage)
+		}
+		priority, ok := parsePriority(rest[0])
+		if !ok {
+			return ephemeralResponse(fmt.Sprintf("❌ `%s` is not a priority. Use P0 (highest), P1, P2, P3 (lowest) or none.", rest[0]))
+		}
+		change = func(task *TaskItem) {
+			task.Priority = priority
+		}
+		confirmation = fmt.Sprintf("🏷️ #%d **%s** is now %s", number, task.Text, strings.TrimSpace(priorityBadge(TaskItem{Priority: priority})))
+		if priority == "" {
+			confirmation = fmt.Sprintf("🏷️ #%d **%s** no longer has a priority", number, task.Text)
+		}
+	}
+
+	var previous TaskItem
+	updated, err := p.store.UpdateTask(scope, task.ID, func(stored *TaskItem, _ []TaskGroup) error {
+		previous = *stored
+		change(stored)
+		setCompletedAt(stored, previous)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errTaskNotFound) {
+			return ephemeralResponse(fmt.Sprintf("❌ There is no task #%d %s.", number, location))
+		}
+		p.API.LogError("Failed to update task from slash command", "scope", string(scope.Kind), "id", scope.ID, "task_id", task.ID, "error", err.Error())
+		return ephemeralResponse("❌ Error saving the task. Please try again.")
+	}
+	p.notifyAssignmentChanges(args.UserId, scope, previous.AssigneeIDs, updated)
+	p.publishTaskEvent(scope, eventTaskUpdated, updated)
+	p.recordTaskHistory(args.UserId, scope, &previous, updated)
+
+	return ephemeralResponse(confirmation)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTaskInput(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	day := func(month time.Month, d int) *time.Time {
+		deadline := time.Date(2026, month, d, 0, 0, 0, 0, time.UTC)
+		return &deadline
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    *taskInput
+		wantErr string
+	}{
+		{
+			name:  "text only",
+			input: "Ship release notes",
+			want:  &taskInput{Text: "Ship release notes"},
+		},
+		{
+			name:  "mentions, deadline and group",
+			input: "Ship release notes @alice @bob, due:friday #Release",
+			want:  &taskInput{Text: "Ship release notes", Usernames: []string{"alice", "bob"}, Deadline: day(10, 16), GroupName: "Release"},
+		},
+		{
+			name:  "ISO deadline",
+			input: "Pay invoice DUE:2026-11-01",
+			want:  &taskInput{Text: "Pay invoice", Deadline: day(11, 1)},
+		},
+		{
+			name:  "flags with quoted values",
+			input: `"Ship release notes" --assignee @alice --due "next week" --group "Release 2"`,
+			want:  &taskInput{Text: "Ship release notes", Usernames: []string{"alice"}, Deadline: day(10, 21), GroupName: "Release 2"},
+		},
+		{
+			name:  "lone @ and # are text",
+			input: "Meet @ 5 in room #",
+			want:  &taskInput{Text: "Meet @ 5 in room #"},
+		},
+		{
+			name:    "unknown date",
+			input:   "Ship due:someday",
+			wantErr: "I don't understand the date `someday`",
+		},
+		{
+			name:    "flag without value",
+			input:   "Ship --group",
+			wantErr: "`--group` needs a value",
+		},
+		{
+			name:    "no text",
+			input:   "@alice due:today",
+			wantErr: "Please describe the task",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTaskInput(strings.Fields(tt.input), now)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
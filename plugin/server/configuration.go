@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// configuration holds the settings from the System Console, see settings_schema in plugin.json.
+// It is replaced rather than changed, so a copy returned by getConfiguration never changes.
+type configuration struct {
+	// DefaultReminderTime is when users who have not chosen a time get their daily summary, in
+	// their time zone. Empty sends it on their first activity of the day.
+	DefaultReminderTime string
+	// DailySummaryDefaultOn decides whether users who never ran /tasks message on or off get the
+	// daily summary.
+	DailySummaryDefaultOn bool
+	BotDisplayName        string
+	EnablePrivateTasks    bool
+	EnableChannelDigests  bool
+	// TrashRetentionDays is how long deleted tasks and groups can be restored. Zero keeps them
+	// until they are restored.
+	TrashRetentionDays int
+}
+
+// defaultConfiguration is used until the settings are loaded. It matches the defaults in
+// plugin.json.
+func defaultConfiguration() *configuration {
+	return &configuration{
+		DailySummaryDefaultOn: true,
+		BotDisplayName:        botDisplayName,
+		EnablePrivateTasks:    true,
+		EnableChannelDigests:  true,
+		TrashRetentionDays:    defaultTrashRetentionDays,
+	}
+}
+
+// summaryTime returns the configured default summary time as "15:04", or "" when it is unset or
+// not a valid time.
+func (c *configuration) summaryTime() string {
+	summaryTime, _ := parseSummaryTime(c.DefaultReminderTime)
+	return summaryTime
+}
+
+// trashRetention returns how long deleted tasks and groups are kept. Zero keeps them until they
+// are restored.
+func (c *configuration) trashRetention() time.Duration {
+	if c.TrashRetentionDays < 0 {
+		return defaultTrashRetentionDays * 24 * time.Hour
+	}
+	return time.Duration(c.TrashRetentionDays) * 24 * time.Hour
+}
+
+// botName returns the display name of the bot, falling back to the default when it is blank.
+func (c *configuration) botName() string {
+	if name := strings.TrimSpace(c.BotDisplayName); name != "" {
+		return name
+	}
+	return botDisplayName
+}
+
+// getConfiguration returns the active configuration. It is safe to call from any goroutine.
+func (p *Plugin) getConfiguration() *configuration {
+	p.configurationLock.RLock()
+	defer p.configurationLock.RUnlock()
+
+	if p.configuration == nil {
+		return defaultConfiguration()
+	}
+	return p.configuration
+}
+
+func (p *Plugin) setConfiguration(config *configuration) {
+	p.configurationLock.Lock()
+	defer p.configurationLock.Unlock()
+
+	p.configuration = config
+}
+
+// OnConfigurationChange loads the settings when the plugin starts and whenever they are saved in
+// the System Console.
+func (p *Plugin) OnConfigurationChange() error {
+	config := defaultConfiguration()
+	if err := p.API.LoadPluginConfiguration(config); err != nil {
+		return fmt.Errorf("failed to load plugin configuration: %w", err)
+	}
+	if config.DefaultReminderTime != "" && config.summaryTime() == "" {
+		p.API.LogWarn("Ignoring invalid default summary time", "value", config.DefaultReminderTime)
+	}
+
+	previous := p.getConfiguration()
+	p.setConfiguration(config)
+
+	// The bot is created in OnActivate, which runs after the first call.
+	if p.botUserID != "" && previous.botName() != config.botName() {
+		if _, err := p.ensureBot(); err != nil {
+			p.API.LogWarn("Failed to rename bot", "error", err.Error())
+		}
+	}
+	return nil
+}
+
+// handleConfig tells the webapp which features are enabled.
+func (p *Plugin) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	config := p.getConfiguration()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		PrivateTasksEnabled   bool `json:"private_tasks_enabled"`
+		ChannelDigestsEnabled bool `json:"channel_digests_enabled"`
+	}{config.EnablePrivateTasks, config.EnableChannelDigests})
+}
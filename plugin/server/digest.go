@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+const (
+	digestPrefix = "digest_"
+
+	defaultDigestWeekday = time.Monday
+	defaultDigestTime    = "09:00"
+)
+
+// errDigestNotDue aborts claiming a channel digest that should not be posted now.
+var errDigestNotDue = errors.New("channel digest not due")
+
+// channelDigest is the weekly digest a channel opted into. The schedule is kept in the time zone
+// of the user who set it up, so "Monday 09:00" means their Monday morning.
+type channelDigest struct {
+	Weekday        time.Weekday `json:"weekday"`
+	Time           string       `json:"time"`
+	Timezone       string       `json:"timezone"`
+	ConfiguredBy   string       `json:"configured_by"`
+	LastPostedDate string       `json:"last_posted_date,omitempty"`
+}
+
+func digestKey(channelID string) string {
+	return digestPrefix + channelID
+}
+
+func (d *channelDigest) location() *time.Location {
+	if d.Timezone != "" {
+		if loc, err := time.LoadLocation(d.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// describe renders the schedule for messages, e.g. "every Monday at 09:00 (Europe/London)".
+func (d *channelDigest) describe() string {
+	return fmt.Sprintf("every %s at %s (%s)", d.Weekday, d.Time, d.location())
+}
+
+func (p *Plugin) getChannelDigest(channelID string) (*channelDigest, error) {
+	data, appErr := p.API.KVGet(digestKey(channelID))
+	if appErr != nil {
+		return nil, appErr
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var digest channelDigest
+	if err := p.unmarshalValue(digestKey(channelID), data, &digest); err != nil {
+		return nil, err
+	}
+	return &digest, nil
+}
+
+// parseWeekday accepts a weekday name or its first three letters.
+func parseWeekday(value string) (time.Weekday, bool) {
+	value = strings.ToLower(value)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if value == name || value == name[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// handleDigestCommand runs `/tasks digest`, `/tasks digest weekly [day] [time]` and
+// `/tasks digest off` for the channel the command was run in.
+func (p *Plugin) handleDigestCommand(args *model.CommandArgs, words []string) *model.CommandResponse {
+	if !p.getConfiguration().EnableChannelDigests {
+		return ephemeralResponse("📅 Channel digests are disabled on this server.")
+	}
+	usage := "❌ Usage: `/tasks digest weekly monday 09:00`, `/tasks digest off` or `/tasks digest` to see the schedule"
+
+	if len(words) == 0 {
+		digest, err := p.getChannelDigest(args.ChannelId)
+		if err != nil {
+			p.API.LogError("Failed to load channel digest", "channel_id", args.ChannelId, "error", err.Error())
+			return ephemeralResponse("❌ Error loading the digest settings.")
+		}
+		if digest == nil {
+			return ephemeralResponse("📅 This channel has no task digest. Use `/tasks digest weekly monday 09:00` to post one every week.")
+		}
+		return ephemeralResponse(fmt.Sprintf("📅 The task digest is posted here %s. Use `/tasks digest off` to stop it.", digest.describe()))
+	}
+
+	switch strings.ToLower(words[0]) {
+	case "off":
+		if appErr := p.API.KVDelete(digestKey(args.ChannelId)); appErr != nil {
+			p.API.LogError("Failed to remove channel digest", "channel_id", args.ChannelId, "error", appErr.Error())
+			return ephemeralResponse("❌ Error saving the digest settings. Please try again.")
+		}
+		return ephemeralResponse("🔕 The weekly task digest of this channel is turned off.")
+	case "weekly":
+	default:
+		return ephemeralResponse(usage)
+	}
+
+	digest := &channelDigest{
+		Weekday:      defaultDigestWeekday,
+		Time:         defaultDigestTime,
+		Timezone:     p.userLocation(args.UserId).String(),
+		ConfiguredBy: args.UserId,
+	}
+	for _, word := range words[1:] {
+		if day, ok := parseWeekday(word); ok {
+			digest.Weekday = day
+		} else if digestTime, ok := parseSummaryTime(word); ok {
+			digest.Time = digestTime
+		} else {
+			return ephemeralResponse(usage)
+		}
+	}
+	// Setting up the digest on its own day after its time should not post it straight away.
+	if now := time.Now().In(digest.location()); now.Weekday() == digest.Weekday && summaryTimeReached(digest.Time, now) {
+		digest.LastPostedDate = now.Format("2006-01-02")
+	}
+
+	data, err := marshalValue(digest)
+	if err != nil {
+		return ephemeralResponse("❌ Error saving the digest settings. Please try again.")
+	}
+	if appErr := p.API.KVSet(digestKey(args.ChannelId), data); appErr != nil {
+		p.API.LogError("Failed to save channel digest", "channel_id", args.ChannelId, "error", appErr.Error())
+		return ephemeralResponse("❌ Error saving the digest settings. Please try again.")
+	}
+	return ephemeralResponse(fmt.Sprintf("📅 The task digest will be posted here %s.", digest.describe()))
+}
+
+// runDigestJob posts the channel digests that are due. It runs on one node at a time, see
+// runScheduledJobs. Digests that were set up stay stored while the feature is disabled.
+func (p *Plugin) runDigestJob() {
+	if !p.getConfiguration().EnableChannelDigests {
+		return
+	}
+	keys, err := p.listKeys(func(key string) bool {
+		return strings.HasPrefix(key, digestPrefix)
+	})
+	if err != nil {
+		p.API.LogError("Failed to list channel digests", "error", err.Error())
+		return
+	}
+
+	for _, key := range keys {
+		channelID := strings.TrimPrefix(key, digestPrefix)
+		var now time.Time
+		_, err := casUpdate(p, key, func(digest *channelDigest, exists bool) error {
+			if !exists {
+				return errDigestNotDue
+			}
+			now = time.Now().In(digest.location())
+			today := now.Format("2006-01-02")
+			if now.Weekday() != digest.Weekday || !summaryTimeReached(digest.Time, now) || digest.LastPostedDate == today {
+				return errDigestNotDue
+			}
+			digest.LastPostedDate = today
+			return nil
+		})
+		if errors.Is(err, errDigestNotDue) {
+			continue
+		}
+		if err != nil {
+			p.API.LogWarn("Failed to claim channel digest", "channel_id", channelID, "error", err.Error())
+			continue
+		}
+		p.postChannelDigest(channelID, now)
+	}
+}
+
+// postChannelDigest posts the digest of a channel's tasks: what was completed in the past week,
+// what is overdue or due in the next week, and who owns the open tasks.
+func (p *Plugin) postChannelDigest(channelID string, now time.Time) {
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		p.API.LogWarn("Failed to load channel for digest", "channel_id", channelID, "error", appErr.Error())
+		return
+	}
+	list, err := p.store.GetList(ChannelScope(channelID))
+	if err != nil {
+		p.API.LogWarn("Failed to load tasks for digest", "channel_id", channelID, "error", err.Error())
+		return
+	}
+
+	tasks := tasksWithContext(list, channel.Id, channel.DisplayName, false)
+	_, overdue, today, week, other := p.categorizeTasks(tasks, now)
+
+	weekAgo := startOfDay(now).AddDate(0, 0, -7)
+	var completed []TaskWithContext
+	for _, t := range tasks {
+		if t.Task.Completed && !t.Task.CompletedAt.Before(weekAgo) {
+			completed = append(completed, t)
+		}
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		return completed[i].Task.CompletedAt.Before(completed[j].Task.CompletedAt)
+	})
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("### 📅 Weekly Task Digest for %s\n\n", channel.DisplayName))
+
+	sections := []struct {
+		title string
+		tasks []TaskWithContext
+	}{
+		{"✅ **Completed in the Past Week**", completed},
+		{"🟥 **Past Due**", overdue},
+		{"🟧 **Due Today**", today},
+		{"🟨 **Due in the Next 7 Days**", week},
+	}
+	for _, section := range sections {
+		if len(section.tasks) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%s (%d)\n\n", section.title, len(section.tasks)))
+		p.writeDigestTaskList(&sb, now, section.tasks)
+		sb.WriteString("\n")
+	}
+
+	open := append(append(append(append([]TaskWithContext{}, overdue...), today...), week...), other...)
+	if len(open) == 0 && len(completed) == 0 {
+		sb.WriteString("There are no tasks in this channel yet.\n\n")
+	} else {
+		p.writeDigestOwners(&sb, now, open)
+	}
+	sb.WriteString("_Use `/tasks digest off` to stop this digest._")
+
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channel.Id,
+		Message:   sb.String(),
+	}
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		p.API.LogError("Failed to post channel digest", "channel_id", channelID, "error", appErr.Error())
+	}
+}
+
+// writeDigestTaskList renders tasks with their deadline and assignees.
+func (p *Plugin) writeDigestTaskList(sb *strings.Builder, now time.Time, tasks []TaskWithContext) {
+	for _, t := range tasks {
+		line := fmt.Sprintf("- %s%s%s", taskNumberLabel(t.Task), priorityBadge(t.Task), t.Task.Text)
+		if t.GroupName != "" {
+			line += fmt.Sprintf(" | **%s**", t.GroupName)
+		}
+		if t.Task.Deadline != nil && !t.Task.Completed {
+			line += " |" + p.formatDeadline(t.Task.Deadline, now)
+		}
+		if len(t.Task.AssigneeIDs) > 0 {
+			line += " | " + p.userNames(t.Task.AssigneeIDs)
+		}
+		sb.WriteString(line + "\n")
+	}
+}
+
+// writeDigestOwners renders a table of open tasks per assignee.
+func (p *Plugin) writeDigestOwners(sb *strings.Builder, now time.Time, open []TaskWithContext) {
+	type counts struct {
+		open, overdue, week int
+	}
+	owners := make(map[string]*counts)
+	todayStart := startOfDay(now)
+	weekEnd := todayStart.AddDate(0, 0, 7)
+	for _, t := range open {
+		ids := t.Task.AssigneeIDs
+		if len(ids) == 0 {
+			ids = []string{""}
+		}
+		for _, id := range ids {
+			c := owners[id]
+			if c == nil {
+				c = &counts{}
+				owners[id] = c
+			}
+			c.open++
+			if t.Task.Deadline == nil {
+				continue
+			}
+			deadline := localDeadline(*t.Task.Deadline, now.Location())
+			if deadline.Before(todayStart) {
+				c.overdue++
+			} else if deadline.Before(weekEnd) {
+				c.week++
+			}
+		}
+	}
+	if len(owners) == 0 {
+		return
+	}
+
+	type row struct {
+		name string
+		counts
+	}
+	rows := make([]row, 0, len(owners))
+	for id, c := range owners {
+		name := "_Unassigned_"
+		if id != "" {
+			name = p.userName(id)
+		}
+		rows = append(rows, row{name, *c})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].open != rows[j].open {
+			return rows[i].open > rows[j].open
+		}
+		return rows[i].name < rows[j].name
+	})
+
+	sb.WriteString("👥 **Who Owns What**\n\n")
+	sb.WriteString("| Assignee | Open | Past due | Due in 7 days |\n|---|---|---|---|\n")
+	for _, r := range rows {
+		sb.WriteString(fmt.Sprintf("| %s | %d | %d | %d |\n", r.name, r.open, r.overdue, r.week))
+	}
+	sb.WriteString("\n")
+}
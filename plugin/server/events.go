@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// The WebSocket events published after every change to a task list. Clients receive them as
+// "custom_com.mattermost.channel-task_<event>" and patch their copy of the list with the entity
+// in the payload instead of fetching the whole list again.
+const (
+	eventTaskCreated  = "task_created"
+	eventTaskUpdated  = "task_updated"
+	eventTaskDeleted  = "task_deleted"
+	eventGroupCreated = "group_created"
+	eventGroupUpdated = "group_updated"
+	// eventGroupDeleted also means the tasks of the group were moved out of it.
+	eventGroupDeleted = "group_deleted"
+)
+
+// listBroadcast returns who may see the changes to a list: the members of its channel, or the
+// owner of a private list.
+func listBroadcast(scope Scope) *model.WebsocketBroadcast {
+	switch scope.Kind {
+	case ScopePrivate:
+		return &model.WebsocketBroadcast{UserId: scope.ID}
+	default:
+		return &model.WebsocketBroadcast{ChannelId: scope.ID}
+	}
+}
+
+func (p *Plugin) publishTaskEvent(scope Scope, event string, task *TaskItem) {
+	p.publishListEvent(scope, event, "task", task)
+}
+
+func (p *Plugin) publishGroupEvent(scope Scope, event string, group *TaskGroup) {
+	p.publishListEvent(scope, event, "group", group)
+}
+
+// publishListEvent sends an event about a list with the changed entity under name. The payload
+// names the list with "scope" and, for channel lists, "channel_id". The entity is sent as JSON
+// because the plugin RPC only carries plain values.
+func (p *Plugin) publishListEvent(scope Scope, event, name string, entity interface{}) {
+	data, err := json.Marshal(entity)
+	if err != nil {
+		p.API.LogWarn("Failed to encode WebSocket event", "event", event, "error", err.Error())
+		return
+	}
+
+	payload := map[string]interface{}{
+		"scope": string(scope.Kind),
+		name:    string(data),
+	}
+	if scope.Kind == ScopeChannel {
+		payload["channel_id"] = scope.ID
+	}
+	p.API.PublishWebSocketEvent(event, payload, listBroadcast(scope))
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+const historyPrefix = "history_"
+
+// maxHistoryEntries caps the entries kept for one task. Once it is reached the oldest entries
+// are dropped, so a task that is edited often does not grow its history without bound.
+const maxHistoryEntries = 200
+
+// The actions recorded in a task's history.
+const (
+	historyCreated  = "created"
+	historyUpdated  = "updated"
+	historyDeleted  = "deleted"
+	historyRestored = "restored"
+)
+
+// historyFields are the fields of a task whose changes are recorded, by their JSON names.
+// created_at is included because the sidebar orders tasks by it when they are dragged.
+var historyFields = []string{"text", "notes", "completed", "assignee_ids", "group_id", "deadline", "priority", "thread_id", "created_at"}
+
+// fieldChange is the value of one task field before and after a change, as JSON. An empty value
+// is null.
+type fieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+type taskHistoryEntry struct {
+	Action  string        `json:"action"`
+	ActorID string        `json:"actor_id"`
+	At      time.Time     `json:"at"`
+	Changes []fieldChange `json:"changes,omitempty"`
+}
+
+// taskHistory is the append-only record of everything that happened to a task. It is kept after
+// the task is deleted, so deletes can be audited too.
+type taskHistory struct {
+	TaskID  string             `json:"task_id"`
+	Number  int64              `json:"number,omitempty"`
+	Entries []taskHistoryEntry `json:"entries"`
+}
+
+// taskHistoryKey includes the list key, so a history can only be read through the list the task
+// belongs to.
+func taskHistoryKey(scope Scope, taskID string) string {
+	return historyPrefix + scope.listKey() + "_" + taskID
+}
+
+// deletedTaskNumberKey holds the ID of the deleted task with the given number, so /tasks history
+// can find its history once the task is no longer in the list.
+func deletedTaskNumberKey(scope Scope, number int64) string {
+	return fmt.Sprintf("%s%s_n%d", historyPrefix, scope.listKey(), number)
+}
+
+// diffTasks returns the recorded fields that differ between two copies of a task. A nil copy
+// stands for a task that does not exist, so every field that is set shows up as a change.
+func diffTasks(before, after *TaskItem) []fieldChange {
+	beforeFields, afterFields := taskFields(before), taskFields(after)
+	var changes []fieldChange
+	for _, field := range historyFields {
+		b, a := beforeFields[field], afterFields[field]
+		if !bytes.Equal(b, a) {
+			changes = append(changes, fieldChange{Field: field, Before: b, After: a})
+		}
+	}
+	return changes
+}
+
+// taskFields returns the recorded fields of a task as JSON, with empty values as null.
+func taskFields(task *TaskItem) map[string]json.RawMessage {
+	var all map[string]json.RawMessage
+	if task != nil {
+		if data, err := json.Marshal(task); err == nil {
+			json.Unmarshal(data, &all)
+		}
+	}
+
+	fields := make(map[string]json.RawMessage, len(historyFields))
+	for _, field := range historyFields {
+		switch value := string(all[field]); value {
+		case "", "null", `""`, "false", "[]", `"0001-01-01T00:00:00Z"`:
+			fields[field] = json.RawMessage("null")
+		default:
+			fields[field] = all[field]
+		}
+	}
+	return fields
+}
+
+// recordTaskHistory appends a change to the history of a task. before is nil for a new task and
+// after is nil for a deleted one. Updates that change no recorded field are skipped.
+func (p *Plugin) recordTaskHistory(actorID string, scope Scope, before, after *TaskItem) {
+	action := historyUpdated
+	switch {
+	case before == nil:
+		action = historyCreated
+	case after == nil:
+		action = historyDeleted
+	}
+	p.appendTaskHistory(actorID, scope, action, before, after)
+}
+
+// appendTaskHistory appends an entry with the given action to the history of a task.
+func (p *Plugin) appendTaskHistory(actorID string, scope Scope, action string, before, after *TaskItem) {
+	task := after
+	if task == nil {
+		task = before
+	}
+	if task == nil {
+		return
+	}
+
+	changes := diffTasks(before, after)
+	if action == historyUpdated && len(changes) == 0 {
+		return
+	}
+	entry := taskHistoryEntry{
+		Action:  action,
+		ActorID: actorID,
+		At:      time.Now(),
+		Changes: changes,
+	}
+
+	if _, err := casUpdate(p, taskHistoryKey(scope, task.ID), func(history *taskHistory, _ bool) error {
+		history.TaskID = task.ID
+		history.Number = task.Number
+		history.Entries = append(history.Entries, entry)
+		if len(history.Entries) > maxHistoryEntries {
+			history.Entries = history.Entries[len(history.Entries)-maxHistoryEntries:]
+		}
+		return nil
+	}); err != nil {
+		p.API.LogError("Failed to record task history", "task_id", task.ID, "action", action, "error", err.Error())
+		return
+	}
+
+	if action == historyDeleted && task.Number != 0 {
+		data, err := marshalValue(task.ID)
+		if err == nil {
+			if appErr := p.API.KVSet(deletedTaskNumberKey(scope, task.Number), data); appErr != nil {
+				err = appErr
+			}
+		}
+		if err != nil {
+			p.API.LogWarn("Failed to record the number of a deleted task", "task_id", task.ID, "error", err.Error())
+		}
+	}
+}
+
+func (p *Plugin) getTaskHistory(scope Scope, taskID string) (*taskHistory, error) {
+	key := taskHistoryKey(scope, taskID)
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var history taskHistory
+	if err := p.unmarshalValue(key, data, &history); err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+// findTaskHistoryByNumber returns the history of the task with the given number, which may have
+// been deleted. Deleted tasks are no longer in the list, so they are found through the number
+// recorded when they were deleted.
+func (p *Plugin) findTaskHistoryByNumber(scope Scope, number int64) (*taskHistory, error) {
+	if task, err := p.findTaskByNumber(scope, number); err == nil {
+		return p.getTaskHistory(scope, task.ID)
+	} else if !errors.Is(err, errTaskNotFound) {
+		return nil, err
+	}
+
+	key := deletedTaskNumberKey(scope, number)
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var taskID string
+	if err := p.unmarshalValue(key, data, &taskID); err != nil {
+		return nil, err
+	}
+	return p.getTaskHistory(scope, taskID)
+}
+
+// handleTaskHistory serves the history of a channel task.
+func (p *Plugin) handleTaskHistory(w http.ResponseWriter, r *http.Request) {
+	channelID := r.URL.Query().Get("channel_id")
+	if channelID == "" {
+		http.Error(w, "channel_id required", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := p.authorizeChannel(w, r, channelID); !ok {
+		return
+	}
+
+	p.serveTaskHistory(w, r, ChannelScope(channelID))
+}
+
+// handlePrivateTaskHistory serves the history of a private task.
+func (p *Plugin) handlePrivateTaskHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := p.resolvePrivateUser(w, r)
+	if !ok {
+		return
+	}
+
+	p.serveTaskHistory(w, r, PrivateScope(userID))
+}
+
+func (p *Plugin) serveTaskHistory(w http.ResponseWriter, r *http.Request, scope Scope) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	taskID := r.URL.Query().Get("id")
+	if taskID == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	history, err := p.getTaskHistory(scope, taskID)
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
+	}
+	if history == nil {
+		writeAPIError(w, http.StatusNotFound, "history_not_found", "No history found for this task")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// handleHistoryCommand runs `/tasks history <number>`, which also works for deleted tasks.
+func (p *Plugin) handleHistoryCommand(args *model.CommandArgs, scope Scope, words []string) *model.CommandResponse {
+	if len(words) == 0 {
+		return ephemeralResponse("❌ Usage: `/tasks history <number>`")
+	}
+	number, ok := parseTaskNumber(words[0])
+	if !ok {
+		return ephemeralResponse(fmt.Sprintf("❌ `%s` is not a task number. Usage: `/tasks history <number>`", words[0]))
+	}
+
+	history, err := p.findTaskHistoryByNumber(scope, number)
+	if err != nil {
+		p.API.LogError("Failed to load task history", "scope", string(scope.Kind), "id", scope.ID, "number", number, "error", err.Error())
+		return ephemeralResponse("❌ Error loading the task history.")
+	}
+	if history == nil || len(history.Entries) == 0 {
+		return ephemeralResponse(fmt.Sprintf("📜 There is no history for task #%d. Changes are recorded from now on.", number))
+	}
+
+	groupNames := make(map[string]string)
+	if list, err := p.store.GetList(scope); err == nil {
+		for _, g := range list.Groups {
+			groupNames[g.ID] = g.Name
+		}
+	}
+
+	now := p.userNow(args.UserId)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("### 📜 History of Task #%d\n\n", number))
+	for _, entry := range history.Entries {
+		sb.WriteString(fmt.Sprintf("- **%s** %s %s", entry.At.In(now.Location()).Format("Jan 2, 2006 15:04"), p.mentionUser(entry.ActorID), entry.Action))
+		var details []string
+		for _, change := range entry.Changes {
+			if detail := p.describeFieldChange(entry.Action, change, groupNames, now.Location()); detail != "" {
+				details = append(details, detail)
+			}
+		}
+		if len(details) > 0 {
+			sb.WriteString(": " + strings.Join(details, "; "))
+		}
+		sb.WriteString("\n")
+	}
+	return ephemeralResponse(sb.String())
+}
+
+// describeFieldChange renders one change for /tasks history. A created task lists its values
+// and a deleted or restored task only its text.
+func (p *Plugin) describeFieldChange(action string, change fieldChange, groupNames map[string]string, loc *time.Location) string {
+	if (action == historyDeleted || action == historyRestored) && change.Field != "text" {
+		return ""
+	}
+	if action == historyCreated && change.Field == "created_at" {
+		return ""
+	}
+
+	value := func(raw json.RawMessage) string {
+		return p.describeFieldValue(change.Field, raw, groupNames, loc)
+	}
+	switch {
+	case change.Field == "created_at":
+		return "moved in the list"
+	case change.Field == "notes" && action == historyUpdated:
+		return "changed the notes"
+	case action == historyCreated:
+		return fmt.Sprintf("%s %s", historyFieldLabel(change.Field), value(change.After))
+	case action == historyDeleted:
+		return value(change.Before)
+	case action == historyRestored:
+		return value(change.After)
+	default:
+		return fmt.Sprintf("%s %s → %s", historyFieldLabel(change.Field), value(change.Before), value(change.After))
+	}
+}
+
+func historyFieldLabel(field string) string {
+	switch field {
+	case "assignee_ids":
+		return "assignees"
+	case "group_id":
+		return "group"
+	case "thread_id":
+		return "thread"
+	default:
+		return field
+	}
+}
+
+// describeFieldValue renders a recorded field value, with users, groups and deadlines by name.
+func (p *Plugin) describeFieldValue(field string, raw json.RawMessage, groupNames map[string]string, loc *time.Location) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		switch field {
+		case "completed":
+			return "open"
+		case "assignee_ids":
+			return "nobody"
+		default:
+			return "none"
+		}
+	}
+
+	switch field {
+	case "completed":
+		return "done"
+	case "assignee_ids":
+		var ids []string
+		if json.Unmarshal(raw, &ids) == nil {
+			return p.mentionUsers(ids)
+		}
+	case "group_id":
+		var id string
+		if json.Unmarshal(raw, &id) == nil {
+			if name, ok := groupNames[id]; ok {
+				return "**" + name + "**"
+			}
+			return "a deleted group"
+		}
+	case "deadline":
+		var deadline time.Time
+		if json.Unmarshal(raw, &deadline) == nil {
+			if isDateOnly(deadline) {
+				return deadline.UTC().Format("Jan 2, 2006")
+			}
+			return deadline.In(loc).Format("Jan 2, 2006 15:04")
+		}
+	case "thread_id":
+		return "linked"
+	case "priority":
+		var priority string
+		if json.Unmarshal(raw, &priority) == nil {
+			return priority
+		}
+	default:
+		var text string
+		if json.Unmarshal(raw, &text) == nil {
+			return fmt.Sprintf("%q", text)
+		}
+	}
+	return string(raw)
+}
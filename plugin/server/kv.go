@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// valueSchemaVersion is the version written into the envelope of every stored value. Bump it
+// when the shape of a stored value changes and register a migration that upgrades old values.
+const valueSchemaVersion = 1
+
+var errCorruptValue = errors.New("stored value could not be decoded")
+
+// kvEnvelope wraps every value the plugin writes to the KV store.
+type kvEnvelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	Data          json.RawMessage `json:"data"`
+}
+
+func marshalValue(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(kvEnvelope{SchemaVersion: valueSchemaVersion, Data: data})
+}
+
+// openEnvelope returns the payload and schema version of a stored value. Values written before
+// envelopes were introduced are returned unchanged as schema version 0.
+func openEnvelope(data []byte) (json.RawMessage, int, error) {
+	var probe struct {
+		SchemaVersion *int            `json:"schema_version"`
+		Data          json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, 0, err
+	}
+	if probe.SchemaVersion == nil {
+		return data, 0, nil
+	}
+	return probe.Data, *probe.SchemaVersion, nil
+}
+
+// unmarshalValue decodes a stored value into v. A value that cannot be decoded is never treated
+// as empty: it is logged, a copy is preserved under a quarantine key, and errCorruptValue is
+// returned so that callers refuse to overwrite it.
+func (p *Plugin) unmarshalValue(key string, data []byte, v interface{}) error {
+	payload, version, err := openEnvelope(data)
+	if err == nil && version > valueSchemaVersion {
+		err = fmt.Errorf("written by newer schema version %d", version)
+	}
+	if err == nil {
+		err = json.Unmarshal(payload, v)
+	}
+	if err != nil {
+		p.quarantineValue(key, data, err)
+		return fmt.Errorf("%w: %s: %v", errCorruptValue, key, err)
+	}
+	return nil
+}
+
+// quarantineValue keeps a copy of an undecodable value. The copy key includes a hash of the
+// content so repeated reads of the same value do not pile up copies.
+func (p *Plugin) quarantineValue(key string, data []byte, cause error) {
+	sum := fmt.Sprintf("%x", sha1.Sum(data))
+	copyKey := fmt.Sprintf("corrupt_%s_%s", key, sum[:16])
+	if _, appErr := p.API.KVCompareAndSet(copyKey, nil, data); appErr != nil {
+		p.API.LogError("Failed to preserve undecodable value", "key", key, "error", appErr.Error())
+	}
+	p.API.LogError("Stored value could not be decoded; it has been left in place and a copy preserved",
+		"key", key, "copy_key", copyKey, "error", cause.Error())
+}
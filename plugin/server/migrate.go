@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-api/cluster"
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+const (
+	// schemaVersionKey records the version of the last data migration that completed.
+	schemaVersionKey      = "schema_version"
+	migrationLockKey      = "migration_lock"
+	migrationListPageSize = 200
+)
+
+// migration is one step that upgrades the stored data. Steps run in order of Version on
+// activation and must be safe to re-run, since a step that fails part way is retried in full on
+// the next activation.
+type migration struct {
+	Version int
+	Name    string
+	Run     func(p *Plugin) error
+}
+
+var migrations = []migration{
+	{Version: 1, Name: "per-task storage", Run: (*Plugin).migrateToPerTaskStorage},
+	{Version: 2, Name: "versioned value envelopes", Run: (*Plugin).migrateToEnvelopes},
+}
+
+// runMigrations applies every registered migration newer than the stored schema version. Only one
+// node of a cluster runs them at a time; the others wait and then find nothing left to do.
+func (p *Plugin) runMigrations() {
+	mutex, err := cluster.NewMutex(p.API, migrationLockKey)
+	if err != nil {
+		p.API.LogError("Failed to create migration lock", "error", err.Error())
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	applied := 0
+	if data, appErr := p.API.KVGet(schemaVersionKey); appErr != nil {
+		p.API.LogError("Failed to read schema version", "error", appErr.Error())
+		return
+	} else if data != nil {
+		if applied, err = strconv.Atoi(string(data)); err != nil {
+			p.API.LogError("Stored schema version is invalid, not running migrations", "value", string(data))
+			return
+		}
+	}
+
+	for _, m := range migrations {
+		if m.Version <= applied {
+			continue
+		}
+
+		p.API.LogInfo("Running data migration", "version", m.Version, "name", m.Name)
+		if err := m.Run(p); err != nil {
+			p.API.LogError("Data migration failed, it will be retried on the next activation", "version", m.Version, "name", m.Name, "error", err.Error())
+			return
+		}
+
+		if appErr := p.API.KVSet(schemaVersionKey, []byte(strconv.Itoa(m.Version))); appErr != nil {
+			p.API.LogError("Failed to record schema version", "version", m.Version, "error", appErr.Error())
+			return
+		}
+		applied = m.Version
+		p.API.LogInfo("Data migration complete", "version", m.Version, "name", m.Name)
+	}
+}
+
+// listKeys returns every key the plugin has stored that matches the filter.
+func (p *Plugin) listKeys(match func(key string) bool) ([]string, error) {
+	var result []string
+	for page := 0; ; page++ {
+		keys, appErr := p.API.KVList(page, migrationListPageSize)
+		if appErr != nil {
+			return nil, appErr
+		}
+		for _, key := range keys {
+			if match(key) {
+				result = append(result, key)
+			}
+		}
+		if len(keys) < migrationListPageSize {
+			return result, nil
+		}
+	}
+}
+
+// isLegacyTaskListKey reports whether key holds a task list in the old single-blob format, i.e.
+// exactly tasks_<channelID> or private_tasks_<userID>.
+func isLegacyTaskListKey(key string) bool {
+	for _, prefix := range []string{"tasks_", "private_tasks_"} {
+		if strings.HasPrefix(key, prefix) && model.IsValidId(strings.TrimPrefix(key, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateLegacyTaskList converts a list stored as one ChannelTaskList blob under listKey into an
+// index plus one key per task. Tasks are written first, then the index, then the blob is
+// deleted. Every step is idempotent, so a migration that was interrupted is simply finished by
+// the next call.
+func (p *Plugin) migrateLegacyTaskList(listKey string) error {
+	legacy, appErr := p.API.KVGet(listKey)
+	if appErr != nil {
+		return appErr
+	}
+	if legacy == nil {
+		return nil
+	}
+
+	indexData, appErr := p.API.KVGet(taskIndexKey(listKey))
+	if appErr != nil {
+		return appErr
+	}
+
+	if indexData == nil {
+		var list ChannelTaskList
+		if err := p.unmarshalValue(listKey, legacy, &list); err != nil {
+			return err
+		}
+
+		scope, _ := scopeForIndexKey(taskIndexKey(listKey))
+		index := taskListIndex{
+			TaskIDs:         []string{},
+			Groups:          list.Groups,
+			HasEverHadTasks: list.HasEverHadTasks,
+		}
+		for i, task := range list.Items {
+			task.Number = int64(i + 1)
+			index.LastNumber = task.Number
+			data, err := marshalValue(task)
+			if err != nil {
+				return err
+			}
+			// Insert only: if the task key exists it was written by an earlier or concurrent run
+			// and may already have been edited since.
+			saved, appErr := p.API.KVCompareAndSet(taskItemKey(listKey, task.ID), nil, data)
+			if appErr != nil {
+				return appErr
+			}
+			if saved {
+				p.updateDeadlineIndex(scope, task.ID, nil, &task)
+			}
+			index.TaskIDs = append(index.TaskIDs, task.ID)
+		}
+
+		data, err := marshalValue(index)
+		if err != nil {
+			return err
+		}
+		if _, appErr := p.API.KVCompareAndSet(taskIndexKey(listKey), nil, data); appErr != nil {
+			return appErr
+		}
+	}
+
+	if appErr := p.API.KVDelete(listKey); appErr != nil {
+		return appErr
+	}
+
+	p.API.LogInfo("Migrated task list to per-task storage", "key", listKey)
+	return nil
+}
+
+// migrateToPerTaskStorage converts every legacy task list in the KV store. Lists are also
+// migrated on first access, so this only has to catch up with lists nobody has opened yet.
+func (p *Plugin) migrateToPerTaskStorage() error {
+	legacyKeys, err := p.listKeys(isLegacyTaskListKey)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, key := range legacyKeys {
+		if err := p.migrateLegacyTaskList(key); err != nil {
+			p.API.LogError("Failed to migrate task list", "key", key, "error", err.Error())
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d task lists could not be migrated", failed, len(legacyKeys))
+	}
+	return nil
+}
+
+// isEnvelopedKey reports whether key holds a value that migration 2 wraps in an envelope. The
+// list is what existed when that migration was written and must not grow: keys added since are
+// written with marshalValue from the start.
+func isEnvelopedKey(key string) bool {
+	if isLegacyTaskListKey(key) {
+		return false
+	}
+	for _, prefix := range []string{"tasks_", "private_tasks_", "daily_prefs_"} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateToEnvelopes rewrites values stored before envelopes were introduced. Values that cannot
+// be decoded are quarantined by unmarshalValue and left untouched.
+func (p *Plugin) migrateToEnvelopes() error {
+	keys, err := p.listKeys(isEnvelopedKey)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, key := range keys {
+		data, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			return appErr
+		}
+		if data == nil {
+			continue
+		}
+		if _, version, err := openEnvelope(data); err == nil && version > 0 {
+			continue
+		}
+
+		var value json.RawMessage
+		if err := p.unmarshalValue(key, data, &value); err != nil {
+			failed++
+			continue
+		}
+		wrapped, err := marshalValue(value)
+		if err != nil {
+			return err
+		}
+		// A concurrent write already stores an envelope, so losing this race is fine.
+		if _, appErr := p.API.KVCompareAndSet(key, data, wrapped); appErr != nil {
+			return appErr
+		}
+	}
+
+	if failed > 0 {
+		p.API.LogWarn("Some stored values could not be decoded and were left as they are", "count", failed)
+	}
+	return nil
+}
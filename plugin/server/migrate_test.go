@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newKVTestPlugin returns a plugin whose KV store is the returned map, served through a
+// plugintest mock.
+func newKVTestPlugin() (*Plugin, map[string][]byte) {
+	kv := make(map[string][]byte)
+	api := &plugintest.API{}
+	api.On("KVGet", mock.Anything).Return(
+		func(key string) []byte { return kv[key] },
+		func(string) *model.AppError { return nil },
+	)
+	api.On("KVCompareAndSet", mock.Anything, mock.Anything, mock.Anything).Return(
+		func(key string, oldValue, newValue []byte) bool {
+			current, exists := kv[key]
+			if exists != (oldValue != nil) || !bytes.Equal(current, oldValue) {
+				return false
+			}
+			kv[key] = newValue
+			return true
+		},
+		func(string, []byte, []byte) *model.AppError { return nil },
+	)
+	api.On("KVDelete", mock.Anything).Return(func(key string) *model.AppError {
+		delete(kv, key)
+		return nil
+	})
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.store = &kvTaskStore{plugin: p}
+	return p, kv
+}
+
+func TestMigrateLegacyTaskList(t *testing.T) {
+	listKey := "tasks_" + "cccccccccccccccccccccccccc"
+	deadline := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	legacy := ChannelTaskList{
+		Items: []TaskItem{
+			{ID: "t1", Text: "one", GroupID: "g1", Deadline: &deadline},
+			{ID: "t2", Text: "two", Completed: true, Deadline: &deadline},
+			{ID: "t3", Text: "three"},
+		},
+		Groups:          []TaskGroup{{ID: "g1", Name: "Release"}},
+		HasEverHadTasks: true,
+	}
+	edited := TaskItem{ID: "t2", Number: 2, Text: "two, edited", Version: 3}
+
+	tests := []struct {
+		name string
+		// stored is written with marshalValue before the migration runs; legacy lists are
+		// stored without an envelope.
+		stored    map[string]interface{}
+		noLegacy  bool
+		wantIndex *taskListIndex
+		wantTasks map[string]TaskItem
+		// wantDeadlines is the deadline index for the day of deadline.
+		wantDeadlines []string
+	}{
+		{
+			name:     "nothing to migrate",
+			noLegacy: true,
+		},
+		{
+			name: "tasks are stored one per key and numbered",
+			wantIndex: &taskListIndex{
+				TaskIDs:         []string{"t1", "t2", "t3"},
+				Groups:          legacy.Groups,
+				HasEverHadTasks: true,
+				LastNumber:      3,
+			},
+			wantTasks: map[string]TaskItem{
+				"t1": {ID: "t1", Number: 1, Text: "one", GroupID: "g1", Deadline: &deadline},
+				"t2": {ID: "t2", Number: 2, Text: "two", Completed: true, Deadline: &deadline},
+				"t3": {ID: "t3", Number: 3, Text: "three"},
+			},
+			wantDeadlines: []string{"t1"},
+		},
+		{
+			name:   "an interrupted run keeps tasks that were already written",
+			stored: map[string]interface{}{taskItemKey(listKey, "t2"): edited},
+			wantIndex: &taskListIndex{
+				TaskIDs:         []string{"t1", "t2", "t3"},
+				Groups:          legacy.Groups,
+				HasEverHadTasks: true,
+				LastNumber:      3,
+			},
+			wantTasks: map[string]TaskItem{
+				"t1": {ID: "t1", Number: 1, Text: "one", GroupID: "g1", Deadline: &deadline},
+				"t2": edited,
+				"t3": {ID: "t3", Number: 3, Text: "three"},
+			},
+			wantDeadlines: []string{"t1"},
+		},
+		{
+			name: "a finished conversion only deletes the legacy list",
+			stored: map[string]interface{}{
+				taskIndexKey(listKey):      taskListIndex{TaskIDs: []string{"t2"}, LastNumber: 2},
+				taskItemKey(listKey, "t2"): edited,
+				deadlineTasksKey(deadline): []taskRef{},
+			},
+			wantIndex: &taskListIndex{TaskIDs: []string{"t2"}, LastNumber: 2},
+			wantTasks: map[string]TaskItem{"t2": edited},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, kv := newKVTestPlugin()
+			for key, value := range tt.stored {
+				data, err := marshalValue(value)
+				require.NoError(t, err)
+				kv[key] = data
+			}
+			if !tt.noLegacy {
+				data, err := json.Marshal(legacy)
+				require.NoError(t, err)
+				kv[listKey] = data
+			}
+
+			require.NoError(t, p.migrateLegacyTaskList(listKey))
+
+			assert.NotContains(t, kv, listKey)
+			if tt.wantIndex == nil {
+				assert.Empty(t, kv)
+				return
+			}
+
+			var index taskListIndex
+			require.NoError(t, p.unmarshalValue("index", kv[taskIndexKey(listKey)], &index))
+			assert.Equal(t, *tt.wantIndex, index)
+
+			for id, want := range tt.wantTasks {
+				task, err := p.getTask(listKey, id)
+				require.NoError(t, err)
+				require.NotNil(t, task, id)
+				assert.Equal(t, want.Number, task.Number, id)
+				assert.Equal(t, want.Text, task.Text, id)
+				assert.Equal(t, want.Version, task.Version, id)
+				assert.Equal(t, want.Completed, task.Completed, id)
+			}
+
+			var refs []taskRef
+			if data := kv[deadlineTasksKey(deadline)]; data != nil {
+				require.NoError(t, p.unmarshalValue("deadlines", data, &refs))
+			}
+			var ids []string
+			for _, ref := range refs {
+				assert.Equal(t, ScopeChannel, ref.ScopeKind)
+				assert.Equal(t, "cccccccccccccccccccccccccc", ref.ScopeID)
+				ids = append(ids, ref.TaskID)
+			}
+			assert.Equal(t, tt.wantDeadlines, ids)
+		})
+	}
+}
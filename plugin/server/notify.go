@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// UserNotificationPrefs holds the messages a user has opted out of, next to UserDailyPrefs.
+// The zero value sends everything.
+type UserNotificationPrefs struct {
+	AssignmentsOff bool `json:"assignments_off"`
+	RemindersOff   bool `json:"reminders_off"`
+	// ReminderOffsets are how long before a deadline to send reminders, e.g. "1d" or "1h".
+	// Empty means defaultReminderOffsets.
+	ReminderOffsets []string `json:"reminder_offsets,omitempty"`
+}
+
+func notificationPrefsKey(userID string) string {
+	return "notify_prefs_" + userID
+}
+
+func (p *Plugin) getUserNotificationPrefs(userID string) *UserNotificationPrefs {
+	key := notificationPrefsKey(userID)
+	data, err := p.API.KVGet(key)
+	if err != nil || data == nil {
+		return &UserNotificationPrefs{}
+	}
+
+	var prefs UserNotificationPrefs
+	if err := p.unmarshalValue(key, data, &prefs); err != nil {
+		return &UserNotificationPrefs{}
+	}
+	return &prefs
+}
+
+func (p *Plugin) saveUserNotificationPrefs(userID string, prefs *UserNotificationPrefs) error {
+	data, err := marshalValue(prefs)
+	if err != nil {
+		return err
+	}
+	if appErr := p.API.KVSet(notificationPrefsKey(userID), data); appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+func (p *Plugin) handleNotifyCommand(args *model.CommandArgs, words []string) *model.CommandResponse {
+	setting := ""
+	if len(words) > 0 {
+		setting = words[0]
+	}
+	if setting == "reminders" {
+		return p.handleRemindersCommand(args, words[1:])
+	}
+
+	prefs := p.getUserNotificationPrefs(args.UserId)
+	switch setting {
+	case "on":
+		prefs.AssignmentsOff = false
+	case "off":
+		prefs.AssignmentsOff = true
+	default:
+		return ephemeralResponse("❌ Usage: `/tasks notify on`, `/tasks notify off` or `/tasks notify reminders ...`")
+	}
+
+	if err := p.saveUserNotificationPrefs(args.UserId, prefs); err != nil {
+		p.API.LogError("Failed to save notification preferences", "user_id", args.UserId, "error", err.Error())
+		return ephemeralResponse("❌ Error saving your preference. Please try again.")
+	}
+	if prefs.AssignmentsOff {
+		return ephemeralResponse("🔕 You will no longer get a message when you are assigned to or unassigned from a task.")
+	}
+	return ephemeralResponse("🔔 You will get a message when you are assigned to or unassigned from a task.")
+}
+
+// sendDirectMessage posts a message from the bot to a user.
+func (p *Plugin) sendDirectMessage(userID, message string) error {
+	channel, appErr := p.API.GetDirectChannel(userID, p.botUserID)
+	if appErr != nil {
+		return appErr
+	}
+
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channel.Id,
+		Message:   message,
+	}
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+// diffAssignees returns the users in after but not before, and in before but not after.
+func diffAssignees(before, after []string) (added, removed []string) {
+	inBefore := make(map[string]bool, len(before))
+	for _, id := range before {
+		inBefore[id] = true
+	}
+	inAfter := make(map[string]bool, len(after))
+	for _, id := range after {
+		inAfter[id] = true
+		if !inBefore[id] {
+			added = append(added, id)
+		}
+	}
+	for _, id := range before {
+		if !inAfter[id] {
+			removed = append(removed, id)
+		}
+	}
+	return added, removed
+}
+
+// notifyAssignmentChanges tells the users added to or removed from a task's assignees, and the
+// task's thread if it has one. before holds the assignees prior to the change and is empty for
+// new tasks. The messages are sent in the background.
+func (p *Plugin) notifyAssignmentChanges(actorID string, scope Scope, before []string, task *TaskItem) {
+	if !scope.AllowsAssignees() || task == nil {
+		return
+	}
+	added, removed := diffAssignees(before, task.AssigneeIDs)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	go p.sendAssignmentNotifications(actorID, scope.ID, added, removed, *task)
+}
+
+func (p *Plugin) sendAssignmentNotifications(actorID, channelID string, added, removed []string, task TaskItem) {
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		p.API.LogWarn("Failed to load channel for assignment notification", "channel_id", channelID, "error", appErr.Error())
+		return
+	}
+
+	// Users who are not in the channel are not told about the task: it would leak its text and
+	// the channel name to them, and mentioning them in the thread would ask to invite them.
+	added = p.filterChannelMembers(channelID, added)
+	removed = p.filterChannelMembers(channelID, removed)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+
+	actor := p.mentionUser(actorID)
+	where := channelReference(channel)
+	// The deadline and link are rendered for each recipient, in their own time zone.
+	details := func(userID string) string {
+		now := p.userNow(userID)
+		result := ""
+		if task.Deadline != nil {
+			result += " |" + p.formatDeadline(task.Deadline, now)
+		}
+		return result + p.formatTaskLink(task, userID, now.Location())
+	}
+
+	for _, userID := range added {
+		message := fmt.Sprintf("📋 %s assigned you to %s**%s** in %s%s", actor, taskNumberLabel(task), task.Text, where, details(userID))
+		if len(removed) > 0 {
+			message += " | _reassigned from " + p.mentionUsers(removed) + "_"
+		}
+		p.sendAssignmentMessage(actorID, userID, message)
+	}
+	for _, userID := range removed {
+		message := fmt.Sprintf("📋 %s unassigned you from %s**%s** in %s%s", actor, taskNumberLabel(task), task.Text, where, details(userID))
+		if len(added) > 0 {
+			message += " | _reassigned to " + p.mentionUsers(added) + "_"
+		}
+		p.sendAssignmentMessage(actorID, userID, message)
+	}
+
+	if task.ThreadID != "" {
+		p.postAssignmentThreadNote(actor, channel, added, removed, task)
+	}
+}
+
+// filterChannelMembers returns the users in userIDs that are members of the channel.
+func (p *Plugin) filterChannelMembers(channelID string, userIDs []string) []string {
+	var members []string
+	for _, id := range userIDs {
+		if _, appErr := p.API.GetChannelMember(channelID, id); appErr == nil {
+			members = append(members, id)
+		}
+	}
+	return members
+}
+
+// sendAssignmentMessage DMs one user about an assignment change, unless they made the change
+// themselves or opted out.
+func (p *Plugin) sendAssignmentMessage(actorID, userID, message string) {
+	if userID == actorID || p.getUserNotificationPrefs(userID).AssignmentsOff {
+		return
+	}
+	message += "\n_Use `/tasks notify off` to stop these messages._"
+	if err := p.sendDirectMessage(userID, message); err != nil {
+		p.API.LogWarn("Failed to send assignment notification", "user_id", userID, "error", err.Error())
+	}
+}
+
+// postAssignmentThreadNote lets the thread linked to a task know who now owns it.
+func (p *Plugin) postAssignmentThreadNote(actor string, channel *model.Channel, added, removed []string, task TaskItem) {
+	var changes []string
+	if len(added) > 0 {
+		changes = append(changes, "assigned "+p.mentionUsers(added))
+	}
+	if len(removed) > 0 {
+		changes = append(changes, "unassigned "+p.mentionUsers(removed))
+	}
+
+	note := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channel.Id,
+		RootId:    task.ThreadID,
+		Message:   fmt.Sprintf("👤 %s %s on task %s**%s**", actor, strings.Join(changes, " and "), taskNumberLabel(task), task.Text),
+	}
+	if _, appErr := p.API.CreatePost(note); appErr != nil {
+		p.API.LogWarn("Failed to post assignment note in thread", "task_id", task.ID, "root_id", task.ThreadID, "error", appErr.Error())
+	}
+}
+
+func (p *Plugin) mentionUser(userID string) string {
+	if user, appErr := p.API.GetUser(userID); appErr == nil {
+		return "@" + user.Username
+	}
+	return "Someone"
+}
+
+func (p *Plugin) mentionUsers(userIDs []string) string {
+	mentions := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		mentions = append(mentions, p.mentionUser(id))
+	}
+	return strings.Join(mentions, ", ")
+}
+
+// userName names a user without mentioning them: their full name, or their username when they
+// have none. Used in channel posts such as the digest, which should not notify everyone listed.
+func (p *Plugin) userName(userID string) string {
+	if user, appErr := p.API.GetUser(userID); appErr == nil {
+		return user.GetDisplayName(model.ShowFullName)
+	}
+	return "Someone"
+}
+
+func (p *Plugin) userNames(userIDs []string) string {
+	names := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		names = append(names, p.userName(id))
+	}
+	return strings.Join(names, ", ")
+}
+
+// channelReference names a channel in a message: a ~link for channels, the display name for
+// direct and group messages.
+func channelReference(channel *model.Channel) string {
+	if channel.Type == model.ChannelTypeOpen || channel.Type == model.ChannelTypePrivate {
+		return "~" + channel.Name
+	}
+	if channel.DisplayName != "" {
+		return "**" + channel.DisplayName + "**"
+	}
+	return "a direct message"
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// validationError is returned for requests that are well-formed JSON but ask for a change the
+// server does not allow.
+type validationError struct {
+	Field   string
+	Message string
+}
+
+func (e *validationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// taskPatch is a validated JSON merge patch (RFC 7396) for a TaskItem. Nil fields are left
+// untouched; the clear flags record an explicit null.
+type taskPatch struct {
+	Text          *string
+	Notes         *string
+	Completed     *bool
+	AssigneeIDs   []string
+	SetAssignees  bool
+	GroupID       *string
+	Deadline      *time.Time
+	ClearDeadline bool
+	ThreadID      *string
+	Priority      *string
+	Version       int64
+}
+
+// readOnlyTaskFields are owned by the server and cannot be patched.
+var readOnlyTaskFields = map[string]bool{
+	"id":               true,
+	"number":           true,
+	"created_at":       true,
+	"created_by":       true,
+	"completed_at":     true,
+	"updated_at":       true,
+	"source_post_id":   true,
+	"permalink":        true,
+	"last_activity_at": true,
+}
+
+// parseTaskPatch decodes and validates a merge patch body. Private tasks cannot have assignees.
+func parseTaskPatch(body io.Reader, allowAssignees bool) (*taskPatch, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, &validationError{Field: "body", Message: "must be a JSON object"}
+	}
+
+	patch := &taskPatch{}
+	for name, raw := range fields {
+		isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+		if readOnlyTaskFields[name] {
+			return nil, &validationError{Field: name, Message: "is managed by the server and cannot be changed"}
+		}
+
+		switch name {
+		case "text":
+			var text string
+			if isNull || json.Unmarshal(raw, &text) != nil || strings.TrimSpace(text) == "" {
+				return nil, &validationError{Field: name, Message: "must be a non-empty string"}
+			}
+			patch.Text = &text
+		case "notes":
+			notes := ""
+			if !isNull && json.Unmarshal(raw, &notes) != nil {
+				return nil, &validationError{Field: name, Message: "must be a string or null"}
+			}
+			patch.Notes = &notes
+		case "completed":
+			var completed bool
+			if isNull || json.Unmarshal(raw, &completed) != nil {
+				return nil, &validationError{Field: name, Message: "must be a boolean"}
+			}
+			patch.Completed = &completed
+		case "assignee_ids":
+			if !allowAssignees {
+				return nil, &validationError{Field: name, Message: "private tasks cannot have assignees"}
+			}
+			var ids []string
+			if !isNull && json.Unmarshal(raw, &ids) != nil {
+				return nil, &validationError{Field: name, Message: "must be an array of user IDs or null"}
+			}
+			if patch.AssigneeIDs, err = validateAssigneeIDs(ids, allowAssignees); err != nil {
+				return nil, err
+			}
+			patch.SetAssignees = true
+		case "group_id":
+			groupID := ""
+			if !isNull && json.Unmarshal(raw, &groupID) != nil {
+				return nil, &validationError{Field: name, Message: "must be a group ID or null"}
+			}
+			patch.GroupID = &groupID
+		case "deadline":
+			if isNull {
+				patch.ClearDeadline = true
+				continue
+			}
+			var deadline time.Time
+			if json.Unmarshal(raw, &deadline) != nil {
+				return nil, &validationError{Field: name, Message: "must be an RFC 3339 timestamp or null"}
+			}
+			patch.Deadline = &deadline
+		case "thread_id":
+			threadID := ""
+			if !isNull && (json.Unmarshal(raw, &threadID) != nil || !model.IsValidId(threadID)) {
+				return nil, &validationError{Field: name, Message: "must be a post ID or null"}
+			}
+			patch.ThreadID = &threadID
+		case "priority":
+			value := ""
+			if !isNull && json.Unmarshal(raw, &value) != nil {
+				return nil, &validationError{Field: name, Message: "must be a string or null"}
+			}
+			priority, ok := parsePriority(value)
+			if !ok {
+				return nil, &validationError{Field: name, Message: "must be one of P0, P1, P2 or P3, or null"}
+			}
+			patch.Priority = &priority
+		case "version":
+			if json.Unmarshal(raw, &patch.Version) != nil {
+				return nil, &validationError{Field: name, Message: "must be a number"}
+			}
+		default:
+			return nil, &validationError{Field: name, Message: "is not a known task field"}
+		}
+	}
+
+	return patch, nil
+}
+
+// validateAssigneeIDs checks the format of assignee IDs sent by a client and drops duplicates.
+// Private tasks cannot have assignees.
+func validateAssigneeIDs(ids []string, allowAssignees bool) ([]string, error) {
+	if len(ids) > 0 && !allowAssignees {
+		return nil, &validationError{Field: "assignee_ids", Message: "private tasks cannot have assignees"}
+	}
+	var result []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if !model.IsValidId(id) {
+			return nil, &validationError{Field: "assignee_ids", Message: fmt.Sprintf("%q is not a valid user ID", id)}
+		}
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result, nil
+}
+
+// validateGroupID checks that a task's group exists. An empty ID means no group.
+func validateGroupID(groupID string, groups []TaskGroup) error {
+	if groupID == "" {
+		return nil
+	}
+	for _, g := range groups {
+		if g.ID == groupID {
+			return nil
+		}
+	}
+	return &validationError{Field: "group_id", Message: "group does not exist"}
+}
+
+// checkNewAssignees checks that the users added to a task's assignees are members of its
+// channel, as resolveAssignees does for commands. Users who were already assigned are not
+// checked again, so a task can still be saved after one of them leaves the channel.
+func (p *Plugin) checkNewAssignees(scope Scope, before, after []string) error {
+	if !scope.AllowsAssignees() {
+		return nil
+	}
+	added, _ := diffAssignees(before, after)
+	for _, id := range added {
+		if _, appErr := p.API.GetChannelMember(scope.ID, id); appErr != nil {
+			return &validationError{Field: "assignee_ids", Message: fmt.Sprintf("%s is not a member of the channel", id)}
+		}
+	}
+	return nil
+}
+
+// apply merges the patch into task. groups is used to check that a new group exists.
+func (patch *taskPatch) apply(task *TaskItem, groups []TaskGroup) error {
+	if patch.GroupID != nil {
+		if err := validateGroupID(*patch.GroupID, groups); err != nil {
+			return err
+		}
+	}
+
+	if patch.Text != nil {
+		task.Text = *patch.Text
+	}
+	if patch.Notes != nil {
+		task.Notes = *patch.Notes
+	}
+	if patch.SetAssignees {
+		task.AssigneeIDs = patch.AssigneeIDs
+	}
+	if patch.GroupID != nil {
+		task.GroupID = *patch.GroupID
+	}
+	if patch.ClearDeadline {
+		task.Deadline = nil
+	} else if patch.Deadline != nil {
+		task.Deadline = patch.Deadline
+	}
+	if patch.ThreadID != nil {
+		task.ThreadID = *patch.ThreadID
+	}
+	if patch.Priority != nil {
+		task.Priority = *patch.Priority
+	}
+	if patch.Completed != nil {
+		stored := *task
+		task.Completed = *patch.Completed
+		setCompletedAt(task, stored)
+	}
+	return nil
+}
+
+// setCompletedAt keeps CompletedAt under server control: it is stamped when a task becomes
+// complete, preserved while it stays complete and cleared when it is reopened.
+func setCompletedAt(task *TaskItem, stored TaskItem) {
+	switch {
+	case task.Completed && !stored.Completed:
+		task.CompletedAt = time.Now()
+	case task.Completed:
+		task.CompletedAt = stored.CompletedAt
+	default:
+		task.CompletedAt = time.Time{}
+	}
+}
+
+// patchTask applies a merge patch from the request to a task of the scope.
+func (p *Plugin) patchTask(w http.ResponseWriter, r *http.Request, scope Scope) {
+	taskID := r.URL.Query().Get("id")
+	if taskID == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	patch, err := parseTaskPatch(r.Body, scope.AllowsAssignees())
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
+	}
+
+	if patch.ThreadID != nil {
+		if err := p.validateThread(scope, *patch.ThreadID); err != nil {
+			p.writeStoreError(w, err)
+			return
+		}
+	}
+
+	expected, conditional, err := expectedVersion(r, patch.Version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var previous TaskItem
+	result, err := p.store.UpdateTask(scope, taskID, func(task *TaskItem, groups []TaskGroup) error {
+		if err := checkVersion(conditional, expected, task.Version, *task); err != nil {
+			return err
+		}
+		if patch.SetAssignees {
+			if err := p.checkNewAssignees(scope, task.AssigneeIDs, patch.AssigneeIDs); err != nil {
+				return err
+			}
+		}
+		previous = *task
+		return patch.apply(task, groups)
+	})
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
+	}
+	userID := r.Header.Get("Mattermost-User-Id")
+	p.notifyAssignmentChanges(userID, scope, previous.AssigneeIDs, result)
+	p.publishTaskEvent(scope, eventTaskUpdated, result)
+	p.recordTaskHistory(userID, scope, &previous, result)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionETag(result.Version))
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTaskPatch(t *testing.T) {
+	userA, userB := "aaaaaaaaaaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbbbbbbbbbb"
+	threadID := "cccccccccccccccccccccccccc"
+	text, empty, p1 := "Ship it", "", "P1"
+	done := true
+	deadline := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		body           string
+		allowAssignees bool
+		want           *taskPatch
+		wantField      string
+	}{
+		{
+			name: "text and completed",
+			body: `{"text": "Ship it", "completed": true}`,
+			want: &taskPatch{Text: &text, Completed: &done},
+		},
+		{
+			name: "null clears notes, group, thread and deadline",
+			body: `{"notes": null, "group_id": null, "thread_id": null, "deadline": null}`,
+			want: &taskPatch{Notes: &empty, GroupID: &empty, ThreadID: &empty, ClearDeadline: true},
+		},
+		{
+			name: "deadline, thread and priority",
+			body: `{"deadline": "2026-11-01T00:00:00Z", "thread_id": "` + threadID + `", "priority": "p1", "version": 3}`,
+			want: &taskPatch{Deadline: &deadline, ThreadID: &threadID, Priority: &p1, Version: 3},
+		},
+		{
+			name:           "assignees without duplicates",
+			body:           `{"assignee_ids": ["` + userA + `", "` + userB + `", "` + userA + `"]}`,
+			allowAssignees: true,
+			want:           &taskPatch{AssigneeIDs: []string{userA, userB}, SetAssignees: true},
+		},
+		{
+			name:           "null clears assignees",
+			body:           `{"assignee_ids": null}`,
+			allowAssignees: true,
+			want:           &taskPatch{SetAssignees: true},
+		},
+		{name: "not an object", body: `[1]`, wantField: "body"},
+		{name: "empty text", body: `{"text": "  "}`, wantField: "text"},
+		{name: "null text", body: `{"text": null}`, wantField: "text"},
+		{name: "completed not a boolean", body: `{"completed": "yes"}`, wantField: "completed"},
+		{name: "server-owned field", body: `{"created_by": "x"}`, wantField: "created_by"},
+		{name: "unknown field", body: `{"colour": "red"}`, wantField: "colour"},
+		{name: "assignees on a private task", body: `{"assignee_ids": []}`, wantField: "assignee_ids"},
+		{name: "invalid assignee", body: `{"assignee_ids": ["nope"]}`, allowAssignees: true, wantField: "assignee_ids"},
+		{name: "invalid thread", body: `{"thread_id": "nope"}`, wantField: "thread_id"},
+		{name: "invalid deadline", body: `{"deadline": "friday"}`, wantField: "deadline"},
+		{name: "invalid priority", body: `{"priority": "P7"}`, wantField: "priority"},
+		{name: "invalid version", body: `{"version": "3"}`, wantField: "version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTaskPatch(strings.NewReader(tt.body), tt.allowAssignees)
+			if tt.wantField != "" {
+				var invalid *validationError
+				require.True(t, errors.As(err, &invalid), "got %v", err)
+				assert.Equal(t, tt.wantField, invalid.Field)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
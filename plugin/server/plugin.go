@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mattermost/mattermost-plugin-api/cluster"
 	"github.com/mattermost/mattermost-server/v6/model"
 	"github.com/mattermost/mattermost-server/v6/plugin"
 )
@@ -17,30 +18,52 @@ const (
 	botUsername    = "channeltasks"
 	botDisplayName = "Channel Tasks"
 	botDescription = "A bot that sends daily task reminders."
+
+	// pluginID must match the id in plugin.json. It is used to build URLs that Mattermost routes
+	// back to the plugin, such as the submit URL of a dialog.
+	pluginID = "com.mattermost.channel-task"
 )
 
 type Plugin struct {
 	plugin.MattermostPlugin
+	botUserID string
+	store     TaskStore
+
+	// configurationLock guards configuration, which is replaced by OnConfigurationChange while
+	// hooks and the scheduler read it. Use getConfiguration.
 	configurationLock sync.RWMutex
-	botUserID         string
+	configuration     *configuration
+
+	// jobs are the scheduled cluster jobs, see startScheduler.
+	jobs []*cluster.Job
 }
 
 type TaskItem struct {
-	ID          string     `json:"id"`
-	Text        string     `json:"text"`
-	Notes       string     `json:"notes"`
-	Completed   bool       `json:"completed"`
-	AssigneeIDs []string   `json:"assignee_ids,omitempty"`
-	GroupID     string     `json:"group_id,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
-	CompletedAt time.Time  `json:"completed_at,omitempty"`
-	Deadline    *time.Time `json:"deadline,omitempty"`
+	ID             string     `json:"id"`
+	Number         int64      `json:"number,omitempty"`
+	Text           string     `json:"text"`
+	Notes          string     `json:"notes"`
+	Completed      bool       `json:"completed"`
+	AssigneeIDs    []string   `json:"assignee_ids,omitempty"`
+	GroupID        string     `json:"group_id,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	CreatedBy      string     `json:"created_by,omitempty"`
+	CompletedAt    time.Time  `json:"completed_at,omitempty"`
+	Deadline       *time.Time `json:"deadline,omitempty"`
+	Priority       string     `json:"priority,omitempty"`
+	Version        int64      `json:"version"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	SourcePostID   string     `json:"source_post_id,omitempty"`
+	Permalink      string     `json:"permalink,omitempty"`
+	ThreadID       string     `json:"thread_id,omitempty"`
+	LastActivityAt *time.Time `json:"last_activity_at,omitempty"`
 }
 
 type TaskGroup struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Order string `json:"order,omitempty"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Order   string `json:"order,omitempty"`
+	Version int64  `json:"version"`
 }
 
 type ChannelTaskList struct {
@@ -50,82 +73,92 @@ type ChannelTaskList struct {
 }
 
 type UserDailyPrefs struct {
-	Enabled         bool   `json:"enabled"`
+	Enabled bool `json:"enabled"`
+	// LastMessageDate is the day the last summary was sent, in the user's time zone.
 	LastMessageDate string `json:"last_message_date"`
+	// SummaryTime is the time of day ("15:04") the summary is sent in the user's time zone. When
+	// empty the default time from the configuration is used, and without one the summary is sent
+	// on the user's first activity of the day.
+	SummaryTime string `json:"summary_time,omitempty"`
+	// The remaining fields choose what the summary contains, see summary.go. Their zero values
+	// give the summary everyone got before they could be changed.
+	HiddenSections        []string `json:"hidden_sections,omitempty"`
+	IncludeUndatedPrivate bool     `json:"include_undated_private,omitempty"`
+	ExcludedChannelIDs    []string `json:"excluded_channel_ids,omitempty"`
+	WeekdaysOnly          bool     `json:"weekdays_only,omitempty"`
+	Layout                string   `json:"layout,omitempty"`
 }
 
 type TaskWithContext struct {
-	Task        TaskItem
-	GroupName   string
-	ChannelID   string
-	ChannelName string
-	IsPrivate   bool
+	Task        TaskItem `json:"task"`
+	GroupName   string   `json:"group_name"`
+	ChannelID   string   `json:"channel_id,omitempty"`
+	ChannelName string   `json:"channel_name"`
+	IsPrivate   bool     `json:"is_private"`
 }
 
 func (p *Plugin) OnActivate() error {
+	p.store = &kvTaskStore{plugin: p}
+
 	botUserID, err := p.ensureBot()
 	if err != nil {
 		return fmt.Errorf("failed to ensure bot: %w", err)
 	}
 	p.botUserID = botUserID
 
-	// Daily message commands
-	commands := []struct {
-		Trigger string
-		Desc    string
-	}{
-		{"tasks-message-on", "Enable daily task reminders"},
-		{"tasks-message-off", "Disable daily task reminders"},
-		{"tasks-message-reset", "Reset daily task reminder"},
-		// Channel task commands
-		{"tasks", "Show all tasks in this channel"},
-		{"tasks-mine", "Show tasks assigned to me in this channel"},
-		{"tasks-overdue", "Show tasks due in the past in this channel"},
-		{"tasks-today", "Show tasks due today in this channel"},
-		{"tasks-incomplete", "Show incomplete tasks in this channel"},
-		{"tasks-complete", "Show completed tasks in this channel"},
-		{"tasks-todo", "Show which tasks to focus on next in this channel (incomplete, assigned to me, prioritized by deadline)"},
-		// Private task commands
-		{"tasks-private", "Show all private tasks"},
-		{"tasks-private-overdue", "Show private tasks due in the past"},
-		{"tasks-private-today", "Show private tasks due today"},
-		{"tasks-private-incomplete", "Show incomplete private tasks"},
-		{"tasks-private-complete", "Show completed private tasks"},
-		{"tasks-private-todo", "Show which private tasks to focus on next (incomplete, prioritized by deadline)"},
-		// Aliases - Channel task commands
-		{"t", "Show all tasks in this channel (alias for /tasks)"},
-		{"tmine", "Show tasks assigned to me in this channel (alias for /tasks-mine)"},
-		{"ttodo", "Show which tasks to focus on next in this channel (alias for /tasks-todo)"},
-		// Aliases - Private task commands
-		{"tp", "Show all private tasks (alias for /tasks-private)"},
-		{"tptodo", "Show which private tasks to focus on next (alias for /tasks-private-todo)"},
-	}
-
-	for _, cmd := range commands {
+	if err := p.API.RegisterCommand(&model.Command{
+		Trigger:          "tasks",
+		AutoComplete:     true,
+		AutoCompleteDesc: "Show and manage the tasks of this channel",
+		AutoCompleteHint: "[command]",
+		AutocompleteData: tasksAutocompleteData(),
+	}); err != nil {
+		return fmt.Errorf("failed to register tasks command: %w", err)
+	}
+
+	// The triggers from before /tasks had subcommands keep working as aliases, see
+	// taskCommandAliases. Only the short ones are offered in the autocomplete menu.
+	shortAliases := map[string]bool{"t": true, "tmine": true, "ttodo": true, "tp": true, "tptodo": true}
+	for trigger, words := range taskCommandAliases {
+		if trigger == "tasks" {
+			continue
+		}
 		if err := p.API.RegisterCommand(&model.Command{
-			Trigger:          cmd.Trigger,
-			AutoComplete:     true,
-			AutoCompleteDesc: cmd.Desc,
+			Trigger:          trigger,
+			AutoComplete:     shortAliases[trigger],
+			AutoCompleteDesc: strings.TrimSpace("Alias for /tasks " + strings.Join(words, " ")),
 		}); err != nil {
-			return fmt.Errorf("failed to register %s command: %w", cmd.Trigger, err)
+			return fmt.Errorf("failed to register %s command: %w", trigger, err)
 		}
 	}
 
+	go p.runMigrations()
+	if err := p.startScheduler(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Plugin) OnDeactivate() error {
+	p.stopScheduler()
 	return nil
 }
 
 func (p *Plugin) ensureBot() (string, error) {
+	displayName := p.getConfiguration().botName()
+
 	bot, _ := p.API.GetUserByUsername(botUsername)
 	if bot != nil {
 		if _, err := p.API.PatchBot(bot.Id, &model.BotPatch{
-			DisplayName: model.NewString(botDisplayName),
+			DisplayName: model.NewString(displayName),
 			Description: model.NewString(botDescription),
 		}); err != nil {
 			p.API.LogWarn("Failed to patch bot", "error", err.Error())
 		}
-		bot.FirstName = botDisplayName
+		bot.FirstName = displayName
 		bot.LastName = ""
-		bot.Nickname = botDisplayName
+		bot.Nickname = displayName
 		if _, err := p.API.UpdateUser(bot); err != nil {
 			p.API.LogWarn("Failed to update bot user", "error", err.Error())
 		}
@@ -134,7 +167,7 @@ func (p *Plugin) ensureBot() (string, error) {
 
 	createdBot, appErr := p.API.CreateBot(&model.Bot{
 		Username:    botUsername,
-		DisplayName: botDisplayName,
+		DisplayName: displayName,
 		Description: botDescription,
 	})
 	if appErr != nil {
@@ -143,9 +176,9 @@ func (p *Plugin) ensureBot() (string, error) {
 
 	botUser, err := p.API.GetUser(createdBot.UserId)
 	if err == nil && botUser != nil {
-		botUser.FirstName = botDisplayName
+		botUser.FirstName = displayName
 		botUser.LastName = ""
-		botUser.Nickname = botDisplayName
+		botUser.Nickname = displayName
 		if _, updateErr := p.API.UpdateUser(botUser); updateErr != nil {
 			p.API.LogWarn("Failed to update new bot user", "error", updateErr.Error())
 		}
@@ -161,45 +194,15 @@ func (p *Plugin) ensureBot() (string, error) {
 }
 
 func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
-	trigger := strings.TrimPrefix(strings.Fields(args.Command)[0], "/")
-
-	switch trigger {
-	case "tasks-message-on":
-		return p.handleDailyTasksOn(args)
-	case "tasks-message-off":
-		return p.handleDailyTasksOff(args)
-	case "tasks-message-reset":
-		return p.handleDailyTasksReset(args)
-		// Channel task commands
-	case "tasks", "t":
-		return p.handleTasksCommand(args, "all")
-	case "tasks-mine", "tmine":
-		return p.handleTasksCommand(args, "mine")
-	case "tasks-overdue":
-		return p.handleTasksCommand(args, "overdue")
-	case "tasks-today":
-		return p.handleTasksCommand(args, "today")
-	case "tasks-incomplete":
-		return p.handleTasksCommand(args, "incomplete")
-	case "tasks-complete":
-		return p.handleTasksCommand(args, "complete")
-	case "tasks-todo", "ttodo":
-		return p.handleTasksCommand(args, "todo")
-		// Private task commands
-	case "tasks-private", "tp":
-		return p.handlePrivateTasksCommand(args, "all")
-	case "tasks-private-today":
-		return p.handlePrivateTasksCommand(args, "today")
-	case "tasks-private-overdue":
-		return p.handlePrivateTasksCommand(args, "overdue")
-	case "tasks-private-incomplete":
-		return p.handlePrivateTasksCommand(args, "incomplete")
-	case "tasks-private-complete":
-		return p.handlePrivateTasksCommand(args, "complete")
-	case "tasks-private-todo", "tptodo":
-		return p.handlePrivateTasksCommand(args, "todo")
-	}
-	return &model.CommandResponse{}, nil
+	fields := strings.Fields(args.Command)
+	trigger := strings.TrimPrefix(fields[0], "/")
+
+	aliasWords, ok := taskCommandAliases[trigger]
+	if !ok {
+		return &model.CommandResponse{}, nil
+	}
+	words := append(append([]string{}, aliasWords...), fields[1:]...)
+	return p.runTasksCommand(args, words)
 }
 
 func (p *Plugin) handleDailyTasksOn(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
@@ -236,21 +239,33 @@ func (p *Plugin) handleDailyTasksReset(args *model.CommandArgs) (*model.CommandR
 	}, nil
 }
 
-func (p *Plugin) handleTasksCommand(args *model.CommandArgs, filter string) (*model.CommandResponse, *model.AppError) {
-	list := p.getChannelTaskList(args.ChannelId)
+func (p *Plugin) handleTasksCommand(args *model.CommandArgs, scope Scope, filter string) (*model.CommandResponse, *model.AppError) {
+	list, err := p.store.GetList(scope)
+	if err != nil {
+		if scope.IsPrivate() {
+			p.API.LogError("Failed to load private tasks", "user_id", args.UserId, "error", err.Error())
+			return ephemeralResponse("❌ Error loading private tasks."), nil
+		}
+		p.API.LogError("Failed to load channel tasks", "channel_id", args.ChannelId, "error", err.Error())
+		return ephemeralResponse("❌ Error loading channel tasks."), nil
+	}
 
-	// Get channel name for display
-	channel, chErr := p.API.GetChannel(args.ChannelId)
-	channelName := "This Channel"
-	if chErr == nil && channel != nil {
-		channelName = channel.DisplayName
+	title := "🔒 Private Tasks"
+	channelName := ""
+	if !scope.IsPrivate() {
+		// Get channel name for display
+		channelName = "This Channel"
+		if channel, chErr := p.API.GetChannel(scope.ID); chErr == nil && channel != nil {
+			channelName = channel.DisplayName
+		}
+		title = channelName + " Tasks"
 	}
 
 	if len(list.Items) == 0 {
-		return &model.CommandResponse{
-			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         fmt.Sprintf("📋 No tasks in **%s**.", channelName),
-		}, nil
+		if scope.IsPrivate() {
+			return ephemeralResponse("🔒 No private tasks yet. Use the task sidebar to add some!"), nil
+		}
+		return ephemeralResponse(fmt.Sprintf("📋 No tasks in **%s**.", channelName)), nil
 	}
 
 	groupMap := make(map[string]string)
@@ -258,118 +273,23 @@ func (p *Plugin) handleTasksCommand(args *model.CommandArgs, filter string) (*mo
 		groupMap[g.ID] = g.Name
 	}
 
-	var filtered []TaskItem
-	now := time.Now()
-	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	todayEnd := todayStart.Add(24 * time.Hour)
-	weekEnd := todayStart.Add(7 * 24 * time.Hour)
-
-	switch filter {
-	case "all":
-		filtered = list.Items
-	case "mine":
-		for _, t := range list.Items {
-			for _, aid := range t.AssigneeIDs {
-				if aid == args.UserId {
-					filtered = append(filtered, t)
-					break
-				}
-			}
-		}
-	case "today":
-		for _, t := range list.Items {
-			if t.Deadline != nil && t.Deadline.Before(todayEnd) && !t.Deadline.Before(todayStart) {
-				filtered = append(filtered, t)
-			}
-		}
-	case "overdue":
-		for _, t := range list.Items {
-			if t.Deadline != nil && t.Deadline.Before(todayStart) {
-				filtered = append(filtered, t)
-			}
-		}
-	case "incomplete":
-		for _, t := range list.Items {
-			if !t.Completed {
-				filtered = append(filtered, t)
-			}
-		}
-	case "complete":
-		for _, t := range list.Items {
-			if t.Completed {
-				filtered = append(filtered, t)
-			}
-		}
-	case "todo":
-		// Get tasks assigned to me that are incomplete
-		var myIncomplete []TaskItem
-		for _, t := range list.Items {
-			if t.Completed {
-				continue
-			}
-			for _, aid := range t.AssigneeIDs {
-				if aid == args.UserId {
-					myIncomplete = append(myIncomplete, t)
-					break
-				}
-			}
-		}
-		// Prioritize: today first, then within week, then others
-		var overdueTasks, todayTasks, weekTasks, otherTasks []TaskItem
-		for _, t := range myIncomplete {
-			if t.Deadline == nil {
-				otherTasks = append(otherTasks, t)
-			} else if t.Deadline.Before(todayStart) {
-				overdueTasks = append(overdueTasks, t)
-			} else if t.Deadline.Before(todayEnd) {
-				todayTasks = append(todayTasks, t)
-			} else if t.Deadline.Before(weekEnd) {
-				weekTasks = append(weekTasks, t)
-			} else {
-				otherTasks = append(otherTasks, t)
-			}
-		}
-		// Show today if any, else week if any, else all
-		if len(overdueTasks) > 0 {
-			filtered = overdueTasks
-		} else if len(todayTasks) > 0 {
-			filtered = todayTasks
-		} else if len(weekTasks) > 0 {
-			filtered = weekTasks
-		} else {
-			filtered = myIncomplete
-		}
-	}
-
+	now := p.userNow(args.UserId)
+	filtered := filterTasks(list.Items, scope, filter, args.UserId, now)
 	if len(filtered) == 0 {
-		emptyMsg := p.getEmptyFilterMessage(filter, channelName, false)
-		return &model.CommandResponse{
-			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         emptyMsg,
-		}, nil
+		return ephemeralResponse(p.getEmptyFilterMessage(filter, channelName, scope.IsPrivate())), nil
+	}
+	if filter == "todo" {
+		sortTasksByRank(filtered, now)
+	} else {
+		sortTasksByDeadline(filtered)
 	}
-
-	// Sort by deadline then by text
-	sort.Slice(filtered, func(i, j int) bool {
-		di, dj := filtered[i].Deadline, filtered[j].Deadline
-		if di != nil && dj != nil {
-			if !di.Equal(*dj) {
-				return di.Before(*dj)
-			}
-		} else if di != nil {
-			return true
-		} else if dj != nil {
-			return false
-		}
-		return filtered[i].Text < filtered[j].Text
-	})
 
 	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("### %s Tasks (%s)\n\n", channelName, p.filterLabel(filter)))
+	sb.WriteString(fmt.Sprintf("### %s (%s)\n\n", title, p.filterLabel(filter)))
 
 	for _, t := range filtered {
-		statusIcon := p.getTaskStatusIcon(t, todayEnd, weekEnd)
-		deadlineStr := p.formatDeadline(t.Deadline)
+		statusIcon := p.getTaskStatusIcon(t, now)
+		deadlineStr := p.formatDeadline(t.Deadline, now)
 		groupStr := ""
 		if t.GroupID != "" {
 			if name, ok := groupMap[t.GroupID]; ok {
@@ -379,95 +299,103 @@ func (p *Plugin) handleTasksCommand(args *model.CommandArgs, filter string) (*mo
 		if deadlineStr != "" {
 			deadlineStr = " |" + deadlineStr
 		}
-		sb.WriteString(fmt.Sprintf("- %s %s%s%s\n", statusIcon, t.Text, groupStr, deadlineStr))
+		sb.WriteString(fmt.Sprintf("- %s %s%s%s%s%s%s\n", statusIcon, taskNumberLabel(t), priorityBadge(t), t.Text, groupStr, deadlineStr, p.formatTaskLink(t, args.UserId, now.Location())))
 	}
 
-	return &model.CommandResponse{
-		ResponseType: model.CommandResponseTypeEphemeral,
-		Text:         sb.String(),
-	}, nil
+	return ephemeralResponse(sb.String()), nil
 }
 
-func (p *Plugin) handlePrivateTasksCommand(args *model.CommandArgs, filter string) (*model.CommandResponse, *model.AppError) {
-	key := p.privateTasksKey(args.UserId)
-	data, appErr := p.API.KVGet(key)
-	if appErr != nil {
-		return &model.CommandResponse{
-			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "❌ Error loading private tasks.",
-		}, nil
+// taskNumberLabel prefixes a task with the number used to refer to it in slash commands.
+func taskNumberLabel(task TaskItem) string {
+	if task.Number == 0 {
+		return ""
 	}
+	return fmt.Sprintf("`#%d` ", task.Number)
+}
 
-	taskList := ChannelTaskList{Items: []TaskItem{}, Groups: []TaskGroup{}}
-	if data != nil {
-		json.Unmarshal(data, &taskList)
+func ephemeralResponse(text string) *model.CommandResponse {
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         text,
 	}
+}
 
-	if len(taskList.Items) == 0 {
-		return &model.CommandResponse{
-			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         "🔒 No private tasks yet. Use the task sidebar to add some!",
-		}, nil
+func isAssignedTo(task TaskItem, userID string) bool {
+	for _, aid := range task.AssigneeIDs {
+		if aid == userID {
+			return true
+		}
 	}
+	return false
+}
 
-	groupMap := make(map[string]string)
-	for _, g := range taskList.Groups {
-		groupMap[g.ID] = g.Name
+// filterTasks applies a slash command filter. In a private list every task is the user's own,
+// so "todo" considers all incomplete tasks rather than only those assigned to the user. "todo"
+// always includes P0 and P1 tasks.
+func filterTasks(items []TaskItem, scope Scope, filter, userID string, now time.Time) []TaskItem {
+	todayStart := startOfDay(now)
+	todayEnd := todayStart.AddDate(0, 0, 1)
+	weekEnd := todayStart.AddDate(0, 0, 7)
+	deadline := func(t TaskItem) time.Time {
+		return localDeadline(*t.Deadline, now.Location())
 	}
 
 	var filtered []TaskItem
-	now := time.Now()
-	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	todayEnd := todayStart.Add(24 * time.Hour)
-	weekEnd := todayStart.Add(7 * 24 * time.Hour)
-
 	switch filter {
 	case "all":
-		filtered = taskList.Items
+		filtered = append(filtered, items...)
+	case "mine":
+		for _, t := range items {
+			if isAssignedTo(t, userID) {
+				filtered = append(filtered, t)
+			}
+		}
 	case "today":
-		for _, t := range taskList.Items {
-			if t.Deadline != nil && t.Deadline.Before(todayEnd) && !t.Deadline.Before(todayStart) {
+		for _, t := range items {
+			if t.Deadline != nil && deadline(t).Before(todayEnd) && !deadline(t).Before(todayStart) {
 				filtered = append(filtered, t)
 			}
 		}
 	case "overdue":
-		for _, t := range taskList.Items {
-			if t.Deadline != nil && t.Deadline.Before(todayStart) {
+		for _, t := range items {
+			if t.Deadline != nil && deadline(t).Before(todayStart) {
 				filtered = append(filtered, t)
 			}
 		}
 	case "incomplete":
-		for _, t := range taskList.Items {
+		for _, t := range items {
 			if !t.Completed {
 				filtered = append(filtered, t)
 			}
 		}
 	case "complete":
-		for _, t := range taskList.Items {
+		for _, t := range items {
 			if t.Completed {
 				filtered = append(filtered, t)
 			}
 		}
 	case "todo":
-		// Get incomplete tasks, prioritize by deadline
 		var incomplete []TaskItem
-		for _, t := range taskList.Items {
-			if !t.Completed {
+		for _, t := range items {
+			if !t.Completed && (scope.IsPrivate() || isAssignedTo(t, userID)) {
 				incomplete = append(incomplete, t)
 			}
 		}
-		var overdueTasks, todayTasks, weekTasks, otherTasks []TaskItem
+		// Show overdue if any, else today, else within the week, else everything
+		var overdueTasks, todayTasks, weekTasks, highPriorityTasks []TaskItem
 		for _, t := range incomplete {
+			if isHighPriority(t) {
+				highPriorityTasks = append(highPriorityTasks, t)
+				continue
+			}
 			if t.Deadline == nil {
-				otherTasks = append(otherTasks, t)
-			} else if t.Deadline.Before(todayStart) {
+				continue
+			} else if deadline(t).Before(todayStart) {
 				overdueTasks = append(overdueTasks, t)
-			} else if t.Deadline.Before(todayEnd) {
+			} else if deadline(t).Before(todayEnd) {
 				todayTasks = append(todayTasks, t)
-			} else if t.Deadline.Before(weekEnd) {
+			} else if deadline(t).Before(weekEnd) {
 				weekTasks = append(weekTasks, t)
-			} else {
-				otherTasks = append(otherTasks, t)
 			}
 		}
 		if len(overdueTasks) > 0 {
@@ -478,20 +406,17 @@ func (p *Plugin) handlePrivateTasksCommand(args *model.CommandArgs, filter strin
 			filtered = weekTasks
 		} else {
 			filtered = incomplete
+			break
 		}
+		filtered = append(filtered, highPriorityTasks...)
 	}
+	return filtered
+}
 
-	if len(filtered) == 0 {
-		emptyMsg := p.getEmptyFilterMessage(filter, "", true)
-		return &model.CommandResponse{
-			ResponseType: model.CommandResponseTypeEphemeral,
-			Text:         emptyMsg,
-		}, nil
-	}
-
-	// Sort by deadline then by text
-	sort.Slice(filtered, func(i, j int) bool {
-		di, dj := filtered[i].Deadline, filtered[j].Deadline
+// sortTasksByDeadline orders tasks by deadline, tasks without one last, then by priority and text.
+func sortTasksByDeadline(tasks []TaskItem) {
+	sort.Slice(tasks, func(i, j int) bool {
+		di, dj := tasks[i].Deadline, tasks[j].Deadline
 		if di != nil && dj != nil {
 			if !di.Equal(*dj) {
 				return di.Before(*dj)
@@ -501,31 +426,11 @@ func (p *Plugin) handlePrivateTasksCommand(args *model.CommandArgs, filter strin
 		} else if dj != nil {
 			return false
 		}
-		return filtered[i].Text < filtered[j].Text
-	})
-
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("### 🔒 Private Tasks (%s)\n\n", p.filterLabel(filter)))
-
-	for _, t := range filtered {
-		statusIcon := p.getTaskStatusIcon(t, todayEnd, weekEnd)
-		deadlineStr := p.formatDeadline(t.Deadline)
-		groupStr := ""
-		if t.GroupID != "" {
-			if name, ok := groupMap[t.GroupID]; ok {
-				groupStr = fmt.Sprintf(" | **%s**", name)
-			}
+		if li, lj := priorityLevel(tasks[i].Priority), priorityLevel(tasks[j].Priority); li != lj {
+			return li < lj
 		}
-		if deadlineStr != "" {
-			deadlineStr = " |" + deadlineStr
-		}
-		sb.WriteString(fmt.Sprintf("- %s %s%s%s\n", statusIcon, t.Text, groupStr, deadlineStr))
-	}
-
-	return &model.CommandResponse{
-		ResponseType: model.CommandResponseTypeEphemeral,
-		Text:         sb.String(),
-	}, nil
+		return tasks[i].Text < tasks[j].Text
+	})
 }
 
 func (p *Plugin) filterLabel(filter string) string {
@@ -549,46 +454,48 @@ func (p *Plugin) filterLabel(filter string) string {
 	}
 }
 
-func (p *Plugin) getTaskStatusIcon(task TaskItem, todayEnd, weekEnd time.Time) string {
+// getTaskStatusIcon colours a task by how soon it is due.
+func (p *Plugin) getTaskStatusIcon(task TaskItem, now time.Time) string {
 	if task.Completed {
 		return "🟩"
 	}
 	if task.Deadline == nil {
 		return "⬜"
 	}
-	now := time.Now()
-	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	if task.Deadline.Before(todayStart) {
+	todayStart := startOfDay(now)
+	deadline := localDeadline(*task.Deadline, now.Location())
+	if deadline.Before(todayStart) {
 		return "🟥" // Overdue
 	}
-	if task.Deadline.Before(todayEnd) {
+	if deadline.Before(todayStart.AddDate(0, 0, 1)) {
 		return "🟧" // Due today
 	}
-	if task.Deadline.Before(weekEnd) {
+	if deadline.Before(todayStart.AddDate(0, 0, 7)) {
 		return "🟨" // Due within a week
 	}
 	return "⬜" // No urgent deadline
 }
 
-func (p *Plugin) formatDeadline(deadline *time.Time) string {
+// formatDeadline describes a deadline relative to now, in now's time zone.
+func (p *Plugin) formatDeadline(deadline *time.Time, now time.Time) string {
 	if deadline == nil {
 		return ""
 	}
 
-	now := time.Now()
-	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	tomorrowStart := todayStart.Add(24 * time.Hour)
-	dayAfterTomorrow := todayStart.Add(48 * time.Hour)
+	local := localDeadline(*deadline, now.Location())
+	todayStart := startOfDay(now)
+	tomorrowStart := todayStart.AddDate(0, 0, 1)
+	dayAfterTomorrow := todayStart.AddDate(0, 0, 2)
 
-	if deadline.Before(todayStart) {
+	if local.Before(todayStart) {
 		// Overdue - show the date
-		return fmt.Sprintf(" _due %s_", deadline.Format("Mon Jan 2"))
-	} else if deadline.Before(tomorrowStart) {
+		return fmt.Sprintf(" _due %s_", local.Format("Mon Jan 2"))
+	} else if local.Before(tomorrowStart) {
 		return " _due Today_"
-	} else if deadline.Before(dayAfterTomorrow) {
+	} else if local.Before(dayAfterTomorrow) {
 		return " _due Tomorrow_"
 	}
-	return fmt.Sprintf(" _due %s_", deadline.Format("Mon Jan 2"))
+	return fmt.Sprintf(" _due %s_", local.Format("Mon Jan 2"))
 }
 
 func (p *Plugin) getEmptyFilterMessage(filter, channelName string, isPrivate bool) string {
@@ -619,26 +526,34 @@ func (p *Plugin) getEmptyFilterMessage(filter, channelName string, isPrivate boo
 }
 
 func (p *Plugin) getUserDailyPrefs(userID string) *UserDailyPrefs {
-	key := fmt.Sprintf("daily_prefs_%s", userID)
+	key := dailyPrefsKey(userID)
 	data, err := p.API.KVGet(key)
 	if err != nil || data == nil {
-		return &UserDailyPrefs{Enabled: true}
+		return p.defaultDailyPrefs()
 	}
 
 	var prefs UserDailyPrefs
-	if err := json.Unmarshal(data, &prefs); err != nil {
-		return &UserDailyPrefs{Enabled: true}
+	if err := p.unmarshalValue(key, data, &prefs); err != nil {
+		return p.defaultDailyPrefs()
 	}
 	return &prefs
 }
 
+// defaultDailyPrefs are the preferences of a user who never changed them.
+func (p *Plugin) defaultDailyPrefs() *UserDailyPrefs {
+	return &UserDailyPrefs{Enabled: p.getConfiguration().DailySummaryDefaultOn}
+}
+
 func (p *Plugin) saveUserDailyPrefs(userID string, prefs *UserDailyPrefs) error {
-	key := fmt.Sprintf("daily_prefs_%s", userID)
-	data, err := json.Marshal(prefs)
+	key := dailyPrefsKey(userID)
+	data, err := marshalValue(prefs)
 	if err != nil {
 		return err
 	}
-	return p.API.KVSet(key, data)
+	if appErr := p.API.KVSet(key, data); appErr != nil {
+		return appErr
+	}
+	return nil
 }
 
 func (p *Plugin) UserHasLoggedIn(c *plugin.Context, user *model.User) {
@@ -649,93 +564,129 @@ func (p *Plugin) MessageHasBeenPosted(c *plugin.Context, post *model.Post) {
 	if post.UserId == p.botUserID {
 		return
 	}
+	p.recordThreadActivity(post)
 	p.checkAndSendDailyMessage(post.UserId)
 }
 
 func (p *Plugin) checkAndSendDailyMessage(userID string) {
-	prefs := p.getUserDailyPrefs(userID)
-	if !prefs.Enabled {
-		return
-	}
-
-	today := time.Now().Format("2006-01-02")
-	if prefs.LastMessageDate == today {
+	now := p.userNow(userID)
+	if !p.claimDailySummary(userID, now) {
 		return
 	}
 
-	prefs.LastMessageDate = today
-	p.saveUserDailyPrefs(userID, prefs)
+	go p.sendDailyTaskSummary(userID, now)
+}
 
-	go p.sendDailyTaskSummary(userID)
+// claimDailySummary records that today's summary is being sent to a user, and reports whether it
+// was due: enabled, not sent yet today and past the user's summary time, all in their time zone.
+// The claim is atomic so activity on several nodes and the scheduler never send it twice.
+//
+// The preferences of a user who gets the summary by default are stored on their first activity
+// even when it is not due yet, so runDailySummaryJob sends it at the default summary time.
+func (p *Plugin) claimDailySummary(userID string, now time.Time) bool {
+	today := now.Format("2006-01-02")
+	config := p.getConfiguration()
+	claimed := false
+	_, err := casUpdate(p, dailyPrefsKey(userID), func(prefs *UserDailyPrefs, exists bool) error {
+		claimed = false
+		if !exists {
+			prefs.Enabled = config.DailySummaryDefaultOn
+		}
+		if !prefs.Enabled || prefs.LastMessageDate == today || !summaryTimeReached(prefs.summaryTime(config), now) || prefs.skipsDay(now) {
+			if !exists && prefs.Enabled {
+				return nil
+			}
+			return errSummaryNotDue
+		}
+		prefs.LastMessageDate = today
+		claimed = true
+		return nil
+	})
+	return err == nil && claimed
 }
 
-func (p *Plugin) sendDailyTaskSummary(userID string) {
+func (p *Plugin) sendDailyTaskSummary(userID string, now time.Time) {
+	prefs := p.getUserDailyPrefs(userID)
+
 	// Get channel tasks assigned to user
 	channelTasks := p.getTasksAssignedToUser(userID)
 
-	// Get private tasks with deadlines
+	// Get private tasks
 	privateTasks := p.getPrivateTasksForMessage(userID)
 
-	// Combine all tasks
-	allTasks := append(channelTasks, privateTasks...)
+	// Combine all tasks the user wants to see
+	var allTasks []TaskWithContext
+	for _, t := range append(channelTasks, privateTasks...) {
+		if prefs.includesTask(t) {
+			allTasks = append(allTasks, t)
+		}
+	}
 
 	if len(allTasks) == 0 {
 		return
 	}
 
-	completedYesterdayTasks, overdueTasks, todayTasks, weekTasks, otherTasks := p.categorizeTasks(allTasks)
-
-	var sb strings.Builder
-	sb.WriteString("### Your Daily Task Summary\n\n\n---\n")
-
-	if len(completedYesterdayTasks) > 0 {
-		sb.WriteString("🟩 **Completed Yesterday**\n\n")
-		p.writeTaskList(&sb, completedYesterdayTasks)
-		sb.WriteString("\n---\n")
-	}
-
-	if len(overdueTasks) > 0 {
-		sb.WriteString("🟥 **Past Due**\n\n")
-		p.writeTaskList(&sb, overdueTasks)
-		sb.WriteString("\n---\n")
-	}
-
-	if len(todayTasks) > 0 {
-		sb.WriteString("🟧 **Due Today**\n\n")
-		p.writeTaskList(&sb, todayTasks)
-		sb.WriteString("\n---\n")
-	}
-
-	if len(weekTasks) > 0 {
-		sb.WriteString("🟨 **Due Within 1 Week**\n\n")
-		p.writeTaskList(&sb, weekTasks)
-		sb.WriteString("\n---\n")
-	}
-
-	if len(otherTasks) > 0 {
-		if len(completedYesterdayTasks) > 0 || len(overdueTasks) > 0 || len(todayTasks) > 0 || len(weekTasks) > 0 {
-			sb.WriteString("⬜ **Everything Else**\n\n")
+	completedYesterdayTasks, overdueTasks, todayTasks, weekTasks, otherTasks := p.categorizeTasks(allTasks, now)
+	// High priority tasks that are not due yet get their own section unless the user hid it.
+	var highPriorityTasks []TaskWithContext
+	if !prefs.hidesSection(summaryHighPriority) {
+		var highWeek, highOther []TaskWithContext
+		highWeek, weekTasks = splitHighPriority(weekTasks)
+		highOther, otherTasks = splitHighPriority(otherTasks)
+		highPriorityTasks = append(highWeek, highOther...)
+		sortSummaryTasks(highPriorityTasks, now)
+	}
+	sections := []struct {
+		name  string
+		title string
+		tasks []TaskWithContext
+	}{
+		{summaryCompletedYesterday, "🟩 **Completed Yesterday**", completedYesterdayTasks},
+		{summaryOverdue, "🟥 **Past Due**", overdueTasks},
+		{summaryToday, "🟧 **Due Today**", todayTasks},
+		{summaryHighPriority, "🔥 **High Priority**", highPriorityTasks},
+		{summaryWeek, "🟨 **Due Within 1 Week**", weekTasks},
+		{summaryOther, "⬜ **Everything Else**", otherTasks},
+	}
+
+	compact := prefs.Layout == summaryLayoutCompact
+	var body strings.Builder
+	written := 0
+	for _, section := range sections {
+		if len(section.tasks) == 0 || prefs.hidesSection(section.name) {
+			continue
+		}
+		// A summary of only undated tasks needs no heading.
+		if section.name != summaryOther || written > 0 {
+			body.WriteString(section.title + "\n\n")
+		}
+		if compact {
+			p.writeCompactTaskList(&body, now, section.tasks)
+			body.WriteString("\n")
+		} else {
+			p.writeTaskList(&body, userID, now, section.tasks)
+			body.WriteString("\n---\n")
 		}
-		p.writeTaskList(&sb, otherTasks)
-		sb.WriteString("\n---\n")
+		written++
 	}
 
-	sb.WriteString("_Use `/tasks-message-off` to disable these reminders._\n\n")
-	sb.WriteString("---\n")
-
-	channel, err := p.API.GetDirectChannel(userID, p.botUserID)
-	if err != nil {
-		p.API.LogError("Failed to get direct channel", "error", err.Error())
+	if written == 0 {
 		return
 	}
 
-	post := &model.Post{
-		UserId:    p.botUserID,
-		ChannelId: channel.Id,
-		Message:   sb.String(),
-	}
-
-	if _, err := p.API.CreatePost(post); err != nil {
+	var sb strings.Builder
+	if compact {
+		sb.WriteString("#### Your Daily Task Summary\n")
+		sb.WriteString(body.String())
+		sb.WriteString("_Use `/tasks message settings` to change this summary._\n")
+	} else {
+		sb.WriteString("### Your Daily Task Summary\n\n\n---\n")
+		sb.WriteString(body.String())
+		sb.WriteString("_Use `/tasks message settings` to change this summary or `/tasks message off` to disable these reminders._\n\n")
+		sb.WriteString("---\n")
+	}
+
+	if err := p.sendDirectMessage(userID, sb.String()); err != nil {
 		p.API.LogError("Failed to create daily summary post", "error", err.Error())
 	}
 }
@@ -749,7 +700,11 @@ func (p *Plugin) getTasksAssignedToUser(userID string) []TaskWithContext {
 	}
 
 	for _, channel := range channels {
-		list := p.getChannelTaskList(channel.Id)
+		list, err := p.store.GetList(ChannelScope(channel.Id))
+		if err != nil {
+			p.API.LogError("Failed to load channel tasks for daily summary", "channel_id", channel.Id, "error", err.Error())
+			continue
+		}
 		groupMap := make(map[string]string)
 		for _, g := range list.Groups {
 			groupMap[g.ID] = g.Name
@@ -782,15 +737,13 @@ func (p *Plugin) getTasksAssignedToUser(userID string) []TaskWithContext {
 
 func (p *Plugin) getPrivateTasksForMessage(userID string) []TaskWithContext {
 	var result []TaskWithContext
-
-	key := p.privateTasksKey(userID)
-	data, appErr := p.API.KVGet(key)
-	if appErr != nil || data == nil {
+	if !p.getConfiguration().EnablePrivateTasks {
 		return result
 	}
 
-	var taskList ChannelTaskList
-	if err := json.Unmarshal(data, &taskList); err != nil {
+	taskList, err := p.store.GetList(PrivateScope(userID))
+	if err != nil {
+		p.API.LogError("Failed to load private tasks", "user_id", userID, "error", err.Error())
 		return result
 	}
 
@@ -819,16 +772,16 @@ func (p *Plugin) getPrivateTasksForMessage(userID string) []TaskWithContext {
 	return result
 }
 
-func (p *Plugin) categorizeTasks(tasks []TaskWithContext) (completedYesterdayTasks, overdue, today, week, other []TaskWithContext) {
-	now := time.Now()
-	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	todayEnd := todayStart.Add(24 * time.Hour)
-	weekEnd := todayStart.Add(7 * 24 * time.Hour)
+// categorizeTasks buckets tasks for the daily summary.
+func (p *Plugin) categorizeTasks(tasks []TaskWithContext, now time.Time) (completedYesterdayTasks, overdue, today, week, other []TaskWithContext) {
+	todayStart := startOfDay(now)
+	todayEnd := todayStart.AddDate(0, 0, 1)
+	weekEnd := todayStart.AddDate(0, 0, 7)
 
 	for _, t := range tasks {
 		if t.Task.Completed {
-			completedAt := time.Date(t.Task.CompletedAt.Year(), t.Task.CompletedAt.Month(), t.Task.CompletedAt.Day(), 0, 0, 0, 0, t.Task.CompletedAt.Location())
-			yesterdayStart := todayStart.Add(-24 * time.Hour)
+			completedAt := startOfDay(t.Task.CompletedAt.In(now.Location()))
+			yesterdayStart := todayStart.AddDate(0, 0, -1)
 			if completedAt.Equal(yesterdayStart) {
 				completedYesterdayTasks = append(completedYesterdayTasks, t)
 				continue
@@ -836,16 +789,12 @@ func (p *Plugin) categorizeTasks(tasks []TaskWithContext) (completedYesterdayTas
 			continue
 		}
 
-		if t.IsPrivate && t.Task.Deadline == nil {
-			continue
-		}
-
 		if t.Task.Deadline == nil {
 			other = append(other, t)
 			continue
 		}
 
-		deadline := *t.Task.Deadline
+		deadline := localDeadline(*t.Task.Deadline, now.Location())
 		if deadline.Before(todayStart) {
 			overdue = append(overdue, t)
 		} else if deadline.Before(todayEnd) {
@@ -857,71 +806,115 @@ func (p *Plugin) categorizeTasks(tasks []TaskWithContext) (completedYesterdayTas
 		}
 	}
 
-	sortTasks := func(tasks []TaskWithContext) {
-		sort.Slice(tasks, func(i, j int) bool {
-			// Sort private tasks after channel tasks within same deadline category
-			if tasks[i].IsPrivate != tasks[j].IsPrivate {
-				return !tasks[i].IsPrivate
-			}
-			if tasks[i].ChannelName != tasks[j].ChannelName {
-				return tasks[i].ChannelName < tasks[j].ChannelName
-			}
-			di := tasks[i].Task.Deadline
-			dj := tasks[j].Task.Deadline
-			if di != nil && dj != nil {
-				if !di.Equal(*dj) {
-					return di.Before(*dj)
-				}
-			} else if di != nil {
-				return true
-			} else if dj != nil {
-				return false
-			}
-			return tasks[i].Task.Text < tasks[j].Task.Text
-		})
-	}
-
-	sortTasks(completedYesterdayTasks)
-	sortTasks(overdue)
-	sortTasks(today)
-	sortTasks(week)
-	sortTasks(other)
+	sortSummaryTasks(completedYesterdayTasks, now)
+	sortSummaryTasks(overdue, now)
+	sortSummaryTasks(today, now)
+	sortSummaryTasks(week, now)
+	sortSummaryTasks(other, now)
 
 	return completedYesterdayTasks, overdue, today, week, other
 }
 
-func (p *Plugin) writeTaskList(sb *strings.Builder, tasks []TaskWithContext) {
+// sortSummaryTasks groups tasks by channel, private tasks last, and ranks them within each
+// channel by priority and deadline.
+func sortSummaryTasks(tasks []TaskWithContext, now time.Time) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].IsPrivate != tasks[j].IsPrivate {
+			return !tasks[i].IsPrivate
+		}
+		if tasks[i].ChannelName != tasks[j].ChannelName {
+			return tasks[i].ChannelName < tasks[j].ChannelName
+		}
+		return rankedBefore(tasks[i].Task, tasks[j].Task, now)
+	})
+}
+
+// splitHighPriority separates the P0 and P1 tasks from the others, keeping their order.
+func splitHighPriority(tasks []TaskWithContext) (high, rest []TaskWithContext) {
+	for _, t := range tasks {
+		if isHighPriority(t.Task) {
+			high = append(high, t)
+		} else {
+			rest = append(rest, t)
+		}
+	}
+	return high, rest
+}
+
+// writeTaskList renders tasks for the detailed daily summary, under the name of their channel.
+func (p *Plugin) writeTaskList(sb *strings.Builder, userID string, now time.Time, tasks []TaskWithContext) {
 	lastChannelName := ""
 	for _, t := range tasks {
 		deadlineStr := ""
 		if t.Task.Deadline != nil {
-			deadlineStr = fmt.Sprintf(" | _due %s_", t.Task.Deadline.Format("Mon Jan 2"))
+			deadlineStr = fmt.Sprintf(" | _due %s_", localDeadline(*t.Task.Deadline, now.Location()).Format("Mon Jan 2"))
+		}
+		groupStr := ""
+		if t.Task.GroupID != "" && t.GroupName != "" {
+			groupStr = fmt.Sprintf(" | **%s**", t.GroupName)
 		}
 		if lastChannelName != t.ChannelName {
 			sb.WriteString(fmt.Sprintf("**%s**\n", t.ChannelName))
 			lastChannelName = t.ChannelName
 		}
-		if t.IsPrivate {
-			sb.WriteString(fmt.Sprintf("- %s%s\n", t.Task.Text, deadlineStr))
-		} else {
-			sb.WriteString(fmt.Sprintf("- %s%s\n", t.Task.Text, deadlineStr))
+		linkStr := p.formatTaskLink(t.Task, userID, now.Location())
+		sb.WriteString(fmt.Sprintf("- %s%s%s%s%s%s\n", taskNumberLabel(t.Task), priorityBadge(t.Task), t.Task.Text, groupStr, deadlineStr, linkStr))
+	}
+}
+
+// writeCompactTaskList renders tasks for the compact daily summary, one short line each.
+func (p *Plugin) writeCompactTaskList(sb *strings.Builder, now time.Time, tasks []TaskWithContext) {
+	for _, t := range tasks {
+		details := []string{t.ChannelName}
+		if t.Task.Deadline != nil {
+			details = append(details, localDeadline(*t.Task.Deadline, now.Location()).Format("Mon Jan 2"))
 		}
+		sb.WriteString(fmt.Sprintf("- %s%s _(%s)_\n", priorityBadge(t.Task), t.Task.Text, strings.Join(details, ", ")))
 	}
 }
 
 func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Mattermost-User-Id") == "" {
+		writeAPIError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
 	switch r.URL.Path {
 	case "/api/v1/tasks":
 		p.handleTasks(w, r)
+	case "/api/v1/tasks/history":
+		p.handleTaskHistory(w, r)
+	case "/api/v1/tasks/bulk":
+		p.handleBulkTasks(w, r)
+	case "/api/v1/tasks/from-post":
+		p.handleTaskFromPost(w, r)
 	case "/api/v1/groups":
 		p.handleGroups(w, r)
+	case "/api/v1/trash", "/api/v1/trash/restore":
+		p.handleTrash(w, r)
 	case "/api/v1/activity":
 		p.handleActivity(w, r)
+	case "/api/v1/search":
+		p.handleSearch(w, r)
 	case "/api/v1/private/tasks":
 		p.handlePrivateTasks(w, r)
+	case "/api/v1/private/tasks/history":
+		p.handlePrivateTaskHistory(w, r)
+	case "/api/v1/private/tasks/bulk":
+		p.handlePrivateBulkTasks(w, r)
 	case "/api/v1/private/groups":
 		p.handlePrivateGroups(w, r)
+	case "/api/v1/private/trash", "/api/v1/private/trash/restore":
+		p.handlePrivateTrash(w, r)
+	case "/api/v1/config":
+		p.handleConfig(w, r)
+	case summarySettingsPath:
+		p.handleSummarySettings(w, r)
 	default:
+		if strings.HasPrefix(r.URL.Path, autocompletePath) {
+			p.handleAutocomplete(w, r)
+			return
+		}
 		http.NotFound(w, r)
 	}
 }
@@ -933,11 +926,6 @@ func (p *Plugin) handleActivity(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userID := r.Header.Get("Mattermost-User-Id")
-	if userID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	p.checkAndSendDailyMessage(userID)
 	w.WriteHeader(http.StatusOK)
 }
@@ -949,18 +937,11 @@ func (p *Plugin) handleTasks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	switch r.Method {
-	case http.MethodGet:
-		p.getTasks(w, r, channelID)
-	case http.MethodPost:
-		p.createTask(w, r, channelID)
-	case http.MethodPut:
-		p.updateTask(w, r, channelID)
-	case http.MethodDelete:
-		p.deleteTask(w, r, channelID)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if _, ok := p.authorizeChannel(w, r, channelID); !ok {
+		return
 	}
+
+	p.serveTasks(w, r, ChannelScope(channelID))
 }
 
 func (p *Plugin) handleGroups(w http.ResponseWriter, r *http.Request) {
@@ -970,433 +951,324 @@ func (p *Plugin) handleGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	switch r.Method {
-	case http.MethodPost:
-		p.createGroup(w, r, channelID)
-	case http.MethodPut:
-		p.updateGroup(w, r, channelID)
-	case http.MethodDelete:
-		p.deleteGroup(w, r, channelID)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if _, ok := p.authorizeChannel(w, r, channelID); !ok {
+		return
 	}
+
+	p.serveGroups(w, r, ChannelScope(channelID))
 }
 
 // Private Tasks Handlers
 func (p *Plugin) handlePrivateTasks(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = r.Header.Get("Mattermost-User-Id")
+	userID, ok := p.resolvePrivateUser(w, r)
+	if !ok {
+		return
 	}
-	if userID == "" {
-		http.Error(w, "user_id is required", http.StatusBadRequest)
+
+	p.serveTasks(w, r, PrivateScope(userID))
+}
+
+func (p *Plugin) handlePrivateGroups(w http.ResponseWriter, r *http.Request) {
+	userID, ok := p.resolvePrivateUser(w, r)
+	if !ok {
 		return
 	}
 
+	p.serveGroups(w, r, PrivateScope(userID))
+}
+
+// serveTasks handles the task endpoints of any scope once the caller has been authorized for it.
+func (p *Plugin) serveTasks(w http.ResponseWriter, r *http.Request, scope Scope) {
 	switch r.Method {
 	case http.MethodGet:
-		p.getPrivateTasks(w, userID)
+		p.getTasks(w, r, scope)
 	case http.MethodPost:
-		p.createPrivateTask(w, r, userID)
+		p.createTask(w, r, scope)
 	case http.MethodPut:
-		p.updatePrivateTask(w, r, userID)
+		p.updateTask(w, r, scope)
+	case http.MethodPatch:
+		p.patchTask(w, r, scope)
 	case http.MethodDelete:
-		taskID := r.URL.Query().Get("id")
-		p.deletePrivateTask(w, userID, taskID)
+		p.deleteTask(w, r, scope)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-func (p *Plugin) handlePrivateGroups(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = r.Header.Get("Mattermost-User-Id")
-	}
-	if userID == "" {
-		http.Error(w, "user_id is required", http.StatusBadRequest)
-		return
-	}
-
+// serveGroups handles the group endpoints of any scope once the caller has been authorized for it.
+func (p *Plugin) serveGroups(w http.ResponseWriter, r *http.Request, scope Scope) {
 	switch r.Method {
 	case http.MethodPost:
-		p.createPrivateGroup(w, r, userID)
+		p.createGroup(w, r, scope)
 	case http.MethodPut:
-		p.updatePrivateGroup(w, r, userID)
+		p.updateGroup(w, r, scope)
 	case http.MethodDelete:
-		groupID := r.URL.Query().Get("id")
-		p.deletePrivateGroup(w, userID, groupID)
+		p.deleteGroup(w, r, scope)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-// Private task storage key
-func (p *Plugin) privateTasksKey(userID string) string {
-	return fmt.Sprintf("private_tasks_%s", userID)
-}
-
-func (p *Plugin) getPrivateTasks(w http.ResponseWriter, userID string) {
-	key := p.privateTasksKey(userID)
-	data, appErr := p.API.KVGet(key)
-	if appErr != nil {
-		http.Error(w, appErr.Error(), http.StatusInternalServerError)
-		return
+func (p *Plugin) getTasks(w http.ResponseWriter, r *http.Request, scope Scope) {
+	if scope.Kind == ScopeChannel {
+		if userID := r.Header.Get("Mattermost-User-Id"); userID != "" {
+			p.checkAndSendDailyMessage(userID)
+		}
 	}
 
-	taskList := ChannelTaskList{Items: []TaskItem{}, Groups: []TaskGroup{}}
-	if data != nil {
-		json.Unmarshal(data, &taskList)
-	}
-	if taskList.Items == nil {
-		taskList.Items = []TaskItem{}
-	}
-	if taskList.Groups == nil {
-		taskList.Groups = []TaskGroup{}
+	list, err := p.store.GetList(scope)
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(taskList)
+	writeTaskList(w, r, list)
 }
 
-func (p *Plugin) createPrivateTask(w http.ResponseWriter, r *http.Request, userID string) {
-	var task TaskItem
-	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+// writeTaskList responds with the list and its ETag, or with 304 when the client's copy is current.
+func writeTaskList(w http.ResponseWriter, r *http.Request, list *ChannelTaskList) {
+	etag := listETag(list)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	task.ID = model.NewId()
-	task.CreatedAt = time.Now()
-
-	key := p.privateTasksKey(userID)
-	data, _ := p.API.KVGet(key)
-	taskList := ChannelTaskList{Items: []TaskItem{}, Groups: []TaskGroup{}}
-	if data != nil {
-		json.Unmarshal(data, &taskList)
-	}
-
-	taskList.Items = append(taskList.Items, task)
-	taskList.HasEverHadTasks = true
-
-	newData, _ := json.Marshal(taskList)
-	p.API.KVSet(key, newData)
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(task)
+	json.NewEncoder(w).Encode(list)
 }
 
-func (p *Plugin) updatePrivateTask(w http.ResponseWriter, r *http.Request, userID string) {
-	var updatedTask TaskItem
-	if err := json.NewDecoder(r.Body).Decode(&updatedTask); err != nil {
+func (p *Plugin) createTask(w http.ResponseWriter, r *http.Request, scope Scope) {
+	var item TaskItem
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	key := p.privateTasksKey(userID)
-	data, _ := p.API.KVGet(key)
-	taskList := ChannelTaskList{Items: []TaskItem{}, Groups: []TaskGroup{}}
-	if data != nil {
-		json.Unmarshal(data, &taskList)
-	}
-
-	for i, task := range taskList.Items {
-		if task.ID == updatedTask.ID {
-			if updatedTask.Completed && !task.Completed {
-				updatedTask.CompletedAt = time.Now()
-			}
-			taskList.Items[i] = updatedTask
-			break
-		}
-	}
-
-	newData, _ := json.Marshal(taskList)
-	p.API.KVSet(key, newData)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updatedTask)
-}
-
-func (p *Plugin) deletePrivateTask(w http.ResponseWriter, userID, taskID string) {
-	if taskID == "" {
-		http.Error(w, "id required", http.StatusBadRequest)
+	if err := validatePriority(&item); err != nil {
+		p.writeStoreError(w, err)
 		return
 	}
-
-	key := p.privateTasksKey(userID)
-	data, _ := p.API.KVGet(key)
-	taskList := ChannelTaskList{Items: []TaskItem{}, Groups: []TaskGroup{}}
-	if data != nil {
-		json.Unmarshal(data, &taskList)
+	if err := p.validateThread(scope, item.ThreadID); err != nil {
+		p.writeStoreError(w, err)
+		return
 	}
-
-	for i, task := range taskList.Items {
-		if task.ID == taskID {
-			taskList.Items = append(taskList.Items[:i], taskList.Items[i+1:]...)
-			break
-		}
+	assigneeIDs, err := validateAssigneeIDs(item.AssigneeIDs, scope.AllowsAssignees())
+	if err == nil {
+		err = p.checkNewAssignees(scope, nil, assigneeIDs)
 	}
-
-	newData, _ := json.Marshal(taskList)
-	p.API.KVSet(key, newData)
-
-	w.WriteHeader(http.StatusNoContent)
-}
-
-func (p *Plugin) createPrivateGroup(w http.ResponseWriter, r *http.Request, userID string) {
-	var group TaskGroup
-	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err != nil {
+		p.writeStoreError(w, err)
 		return
 	}
+	item.AssigneeIDs = assigneeIDs
 
-	group.ID = model.NewId()
-
-	key := p.privateTasksKey(userID)
-	data, _ := p.API.KVGet(key)
-	taskList := ChannelTaskList{Items: []TaskItem{}, Groups: []TaskGroup{}}
-	if data != nil {
-		json.Unmarshal(data, &taskList)
+	userID := r.Header.Get("Mattermost-User-Id")
+	// The creator and the post a task was created from are owned by the server. Only tasks
+	// created from a post link back to it.
+	item.CreatedBy = userID
+	item.SourcePostID = ""
+	item.Permalink = ""
+	created, err := p.store.CreateTask(scope, item)
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
 	}
-
-	taskList.Groups = append(taskList.Groups, group)
-
-	newData, _ := json.Marshal(taskList)
-	p.API.KVSet(key, newData)
+	p.notifyAssignmentChanges(userID, scope, nil, created)
+	p.publishTaskEvent(scope, eventTaskCreated, created)
+	p.recordTaskHistory(userID, scope, nil, created)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(group)
+	w.Header().Set("ETag", versionETag(created.Version))
+	json.NewEncoder(w).Encode(created)
 }
 
-func (p *Plugin) updatePrivateGroup(w http.ResponseWriter, r *http.Request, userID string) {
-	var updatedGroup TaskGroup
-	if err := json.NewDecoder(r.Body).Decode(&updatedGroup); err != nil {
+func (p *Plugin) updateTask(w http.ResponseWriter, r *http.Request, scope Scope) {
+	var updated TaskItem
+	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	key := p.privateTasksKey(userID)
-	data, _ := p.API.KVGet(key)
-	taskList := ChannelTaskList{Items: []TaskItem{}, Groups: []TaskGroup{}}
-	if data != nil {
-		json.Unmarshal(data, &taskList)
-	}
-
-	for i, group := range taskList.Groups {
-		if group.ID == updatedGroup.ID {
-			taskList.Groups[i] = updatedGroup
-			break
-		}
+	if err := validatePriority(&updated); err != nil {
+		p.writeStoreError(w, err)
+		return
 	}
 
-	newData, _ := json.Marshal(taskList)
-	p.API.KVSet(key, newData)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updatedGroup)
-}
-
-func (p *Plugin) deletePrivateGroup(w http.ResponseWriter, userID, groupID string) {
-	if groupID == "" {
-		http.Error(w, "id required", http.StatusBadRequest)
+	// A full update is validated like a patch that sets every field.
+	assigneeIDs, err := validateAssigneeIDs(updated.AssigneeIDs, scope.AllowsAssignees())
+	if err != nil {
+		p.writeStoreError(w, err)
 		return
 	}
+	updated.AssigneeIDs = assigneeIDs
 
-	key := p.privateTasksKey(userID)
-	data, _ := p.API.KVGet(key)
-	taskList := ChannelTaskList{Items: []TaskItem{}, Groups: []TaskGroup{}}
-	if data != nil {
-		json.Unmarshal(data, &taskList)
+	expected, conditional, err := expectedVersion(r, updated.Version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	for i, group := range taskList.Groups {
-		if group.ID == groupID {
-			taskList.Groups = append(taskList.Groups[:i], taskList.Groups[i+1:]...)
-			// Also ungroup any tasks in this group
-			for j := range taskList.Items {
-				if taskList.Items[j].GroupID == groupID {
-					taskList.Items[j].GroupID = ""
-				}
+	var previous TaskItem
+	result, err := p.store.UpdateTask(scope, updated.ID, func(item *TaskItem, groups []TaskGroup) error {
+		if err := checkVersion(conditional, expected, item.Version, *item); err != nil {
+			return err
+		}
+		if err := validateGroupID(updated.GroupID, groups); err != nil {
+			return err
+		}
+		if err := p.checkNewAssignees(scope, item.AssigneeIDs, updated.AssigneeIDs); err != nil {
+			return err
+		}
+		if updated.ThreadID != item.ThreadID {
+			if err := p.validateThread(scope, updated.ThreadID); err != nil {
+				return err
 			}
-			break
 		}
+		previous = *item
+		*item = updated
+		// The creator, the post a task was created from and its thread activity are owned by
+		// the server.
+		item.CreatedBy = previous.CreatedBy
+		item.SourcePostID = previous.SourcePostID
+		item.Permalink = previous.Permalink
+		item.LastActivityAt = previous.LastActivityAt
+		setCompletedAt(item, previous)
+		return nil
+	})
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
 	}
-
-	newData, _ := json.Marshal(taskList)
-	p.API.KVSet(key, newData)
-
-	w.WriteHeader(http.StatusNoContent)
-}
-
-// Channel task methods
-func (p *Plugin) getTasks(w http.ResponseWriter, r *http.Request, channelID string) {
 	userID := r.Header.Get("Mattermost-User-Id")
-	if userID != "" {
-		p.checkAndSendDailyMessage(userID)
-	}
+	p.notifyAssignmentChanges(userID, scope, previous.AssigneeIDs, result)
+	p.publishTaskEvent(scope, eventTaskUpdated, result)
+	p.recordTaskHistory(userID, scope, &previous, result)
 
-	list := p.getChannelTaskList(channelID)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(list)
+	w.Header().Set("ETag", versionETag(result.Version))
+	json.NewEncoder(w).Encode(result)
 }
 
-func (p *Plugin) createTask(w http.ResponseWriter, r *http.Request, channelID string) {
-	var item TaskItem
-	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+func (p *Plugin) deleteTask(w http.ResponseWriter, r *http.Request, scope Scope) {
+	taskID := r.URL.Query().Get("id")
+	if taskID == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
 		return
 	}
 
-	item.ID = model.NewId()
-	item.CreatedAt = time.Now()
-
-	list := p.getChannelTaskList(channelID)
-	list.Items = append(list.Items, item)
-	list.HasEverHadTasks = true
-	p.saveChannelTaskList(channelID, list)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(item)
-}
-
-func (p *Plugin) updateTask(w http.ResponseWriter, r *http.Request, channelID string) {
-	var updated TaskItem
-	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+	expected, conditional, err := expectedVersion(r, 0)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	list := p.getChannelTaskList(channelID)
-	for i, item := range list.Items {
-		if item.ID == updated.ID {
-			if updated.Completed && !item.Completed {
-				updated.CompletedAt = time.Now()
-			}
-			list.Items[i] = updated
-			p.saveChannelTaskList(channelID, list)
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(updated)
-			return
-		}
-	}
-
-	http.Error(w, "Task not found", http.StatusNotFound)
-}
-
-func (p *Plugin) deleteTask(w http.ResponseWriter, r *http.Request, channelID string) {
-	taskID := r.URL.Query().Get("id")
-	if taskID == "" {
-		http.Error(w, "id required", http.StatusBadRequest)
+	var deleted TaskItem
+	if err := p.store.DeleteTask(scope, taskID, func(item TaskItem) error {
+		deleted = item
+		return checkVersion(conditional, expected, item.Version, item)
+	}); err != nil {
+		p.writeStoreError(w, err)
 		return
 	}
+	p.publishTaskEvent(scope, eventTaskDeleted, &deleted)
+	p.recordTaskHistory(r.Header.Get("Mattermost-User-Id"), scope, &deleted, nil)
 
-	list := p.getChannelTaskList(channelID)
-	for i, item := range list.Items {
-		if item.ID == taskID {
-			list.Items = append(list.Items[:i], list.Items[i+1:]...)
-			p.saveChannelTaskList(channelID, list)
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-	}
-
-	http.Error(w, "Task not found", http.StatusNotFound)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (p *Plugin) createGroup(w http.ResponseWriter, r *http.Request, channelID string) {
+func (p *Plugin) createGroup(w http.ResponseWriter, r *http.Request, scope Scope) {
 	var group TaskGroup
 	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	group.ID = model.NewId()
-
-	list := p.getChannelTaskList(channelID)
-	list.Groups = append(list.Groups, group)
-	p.saveChannelTaskList(channelID, list)
+	created, err := p.store.CreateGroup(scope, group)
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
+	}
+	p.publishGroupEvent(scope, eventGroupCreated, created)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(group)
+	w.Header().Set("ETag", versionETag(created.Version))
+	json.NewEncoder(w).Encode(created)
 }
 
-func (p *Plugin) updateGroup(w http.ResponseWriter, r *http.Request, channelID string) {
+func (p *Plugin) updateGroup(w http.ResponseWriter, r *http.Request, scope Scope) {
 	var updated TaskGroup
 	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	list := p.getChannelTaskList(channelID)
-	for i, group := range list.Groups {
-		if group.ID == updated.ID {
-			list.Groups[i] = updated
-			p.saveChannelTaskList(channelID, list)
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(updated)
-			return
+	expected, conditional, err := expectedVersion(r, updated.Version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := p.store.UpdateGroup(scope, updated.ID, func(group *TaskGroup) error {
+		if err := checkVersion(conditional, expected, group.Version, *group); err != nil {
+			return err
 		}
+		*group = updated
+		return nil
+	})
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
 	}
+	p.publishGroupEvent(scope, eventGroupUpdated, result)
 
-	http.Error(w, "Group not found", http.StatusNotFound)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionETag(result.Version))
+	json.NewEncoder(w).Encode(result)
 }
 
-func (p *Plugin) deleteGroup(w http.ResponseWriter, r *http.Request, channelID string) {
+func (p *Plugin) deleteGroup(w http.ResponseWriter, r *http.Request, scope Scope) {
 	groupID := r.URL.Query().Get("id")
 	if groupID == "" {
 		http.Error(w, "id required", http.StatusBadRequest)
 		return
 	}
 
-	list := p.getChannelTaskList(channelID)
-	for i, group := range list.Groups {
-		if group.ID == groupID {
-			list.Groups = append(list.Groups[:i], list.Groups[i+1:]...)
-			for j := range list.Items {
-				if list.Items[j].GroupID == groupID {
-					list.Items[j].GroupID = ""
-				}
-			}
-			p.saveChannelTaskList(channelID, list)
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
+	expected, conditional, err := expectedVersion(r, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	http.Error(w, "Group not found", http.StatusNotFound)
-}
-
-func (p *Plugin) getChannelTaskList(channelID string) *ChannelTaskList {
-	key := fmt.Sprintf("tasks_%s", channelID)
-	data, err := p.API.KVGet(key)
-	if err != nil || data == nil {
-		return &ChannelTaskList{
-			Items:           []TaskItem{},
-			Groups:          []TaskGroup{},
-			HasEverHadTasks: false,
+	// The tasks of the group are looked up first so their move out of it can be recorded.
+	var grouped []TaskItem
+	if list, err := p.store.GetList(scope); err == nil {
+		for _, task := range list.Items {
+			if task.GroupID == groupID {
+				grouped = append(grouped, task)
+			}
 		}
 	}
 
-	var list ChannelTaskList
-	if err := json.Unmarshal(data, &list); err != nil {
-		return &ChannelTaskList{
-			Items:           []TaskItem{},
-			Groups:          []TaskGroup{},
-			HasEverHadTasks: false,
-		}
+	// The store also moves the tasks of the group out of it, which clients do themselves when
+	// they get the event.
+	var deleted TaskGroup
+	if err := p.store.DeleteGroup(scope, groupID, func(group TaskGroup) error {
+		deleted = group
+		return checkVersion(conditional, expected, group.Version, group)
+	}); err != nil {
+		p.writeStoreError(w, err)
+		return
 	}
+	p.publishGroupEvent(scope, eventGroupDeleted, &deleted)
 
-	return &list
-}
-
-func (p *Plugin) saveChannelTaskList(channelID string, list *ChannelTaskList) error {
-	key := fmt.Sprintf("tasks_%s", channelID)
-	data, err := json.Marshal(list)
-	if err != nil {
-		return err
+	userID := r.Header.Get("Mattermost-User-Id")
+	for i := range grouped {
+		ungrouped := grouped[i]
+		ungrouped.GroupID = ""
+		p.recordTaskHistory(userID, scope, &grouped[i], &ungrouped)
 	}
 
-	return p.API.KVSet(key, data)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func main() {
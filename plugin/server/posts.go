@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// postTaskTextMaxRunes caps the task text taken from a post. Longer messages, and messages with
+// more than one line, are kept in full in the notes.
+const postTaskTextMaxRunes = 200
+
+var mentionPattern = regexp.MustCompile(`\B@([a-z0-9][a-z0-9._-]*)`)
+
+// specialMentions never resolve to a single assignee.
+var specialMentions = map[string]bool{"all": true, "channel": true, "here": true}
+
+type createTaskFromPostRequest struct {
+	PostID string `json:"post_id"`
+	// TeamID is the team the user is viewing, used for the permalink of posts in DMs and GMs.
+	TeamID string `json:"team_id,omitempty"`
+}
+
+// mentionedUsernames returns the usernames @mentioned in a message, in order and without
+// duplicates.
+func mentionedUsernames(message string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(strings.ToLower(message), -1) {
+		username := strings.TrimRight(match[1], "._-")
+		if username == "" || specialMentions[username] || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// taskTextFromMessage returns the task text and notes for a post: the first line becomes the
+// text, and the whole message is kept in the notes when the text does not cover it.
+func taskTextFromMessage(message string) (text, notes string) {
+	message = strings.TrimSpace(message)
+	text = message
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	if utf8.RuneCountInString(text) > postTaskTextMaxRunes {
+		text = string([]rune(text)[:postTaskTextMaxRunes-1]) + "…"
+	}
+	if text != message {
+		notes = message
+	}
+	return text, notes
+}
+
+// postPermalink returns the link to a post. Posts outside a team (DMs and GMs) are linked
+// through teamID, or through any team of the user when it is empty.
+func (p *Plugin) postPermalink(post *model.Post, channel *model.Channel, userID, teamID string) string {
+	siteURL := ""
+	if config := p.API.GetConfig(); config != nil && config.ServiceSettings.SiteURL != nil {
+		siteURL = strings.TrimRight(*config.ServiceSettings.SiteURL, "/")
+	}
+
+	if channel.TeamId != "" {
+		teamID = channel.TeamId
+	}
+	var team *model.Team
+	if teamID != "" {
+		team, _ = p.API.GetTeam(teamID)
+	}
+	if team == nil {
+		if teams, appErr := p.API.GetTeamsForUser(userID); appErr == nil && len(teams) > 0 {
+			team = teams[0]
+		}
+	}
+	if team == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/pl/%s", siteURL, team.Name, post.Id)
+}
+
+// handleTaskFromPost creates a task in a post's channel from the post. The text defaults to the
+// message and the assignees to the channel members it mentions. The bot replies in the post's
+// thread so the conversation links to the task.
+func (p *Plugin) handleTaskFromPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req createTaskFromPostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !model.IsValidId(req.PostID) {
+		writeAPIError(w, http.StatusBadRequest, "invalid_post_id", "post_id must be a valid post ID")
+		return
+	}
+
+	post, appErr := p.API.GetPost(req.PostID)
+	if appErr != nil {
+		writeAPIError(w, http.StatusNotFound, "post_not_found", "Post not found")
+		return
+	}
+
+	userID, ok := p.authorizeChannel(w, r, post.ChannelId)
+	if !ok {
+		return
+	}
+
+	channel, appErr := p.API.GetChannel(post.ChannelId)
+	if appErr != nil {
+		p.writeStoreError(w, appErr)
+		return
+	}
+
+	text, notes := taskTextFromMessage(post.Message)
+	if text == "" {
+		writeAPIError(w, http.StatusBadRequest, "empty_post", "The post has no text to turn into a task")
+		return
+	}
+
+	threadID := post.RootId
+	if threadID == "" {
+		threadID = post.Id
+	}
+
+	task := TaskItem{
+		Text:         text,
+		Notes:        notes,
+		CreatedBy:    userID,
+		SourcePostID: post.Id,
+		Permalink:    p.postPermalink(post, channel, userID, req.TeamID),
+		ThreadID:     threadID,
+	}
+
+	// Mentions of people outside the channel or of unknown users are left in the text only.
+	for _, username := range mentionedUsernames(post.Message) {
+		if ids, err := p.resolveAssignees([]string{username}, ChannelScope(channel.Id)); err == nil {
+			task.AssigneeIDs = append(task.AssigneeIDs, ids...)
+		}
+	}
+
+	created, err := p.store.CreateTask(ChannelScope(channel.Id), task)
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
+	}
+
+	p.replyTaskCreatedFromPost(post, userID, created)
+	p.notifyAssignmentChanges(userID, ChannelScope(channel.Id), nil, created)
+	p.publishTaskEvent(ChannelScope(channel.Id), eventTaskCreated, created)
+	p.recordTaskHistory(userID, ChannelScope(channel.Id), nil, created)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionETag(created.Version))
+	json.NewEncoder(w).Encode(created)
+}
+
+// replyTaskCreatedFromPost lets the thread know that a task now tracks it.
+func (p *Plugin) replyTaskCreatedFromPost(post *model.Post, userID string, task *TaskItem) {
+	rootID := post.RootId
+	if rootID == "" {
+		rootID = post.Id
+	}
+
+	reply := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: post.ChannelId,
+		RootId:    rootID,
+		Message:   fmt.Sprintf("📋 %s created task #%d **%s** from this message.", p.mentionUser(userID), task.Number, task.Text),
+	}
+	if _, appErr := p.API.CreatePost(reply); appErr != nil {
+		p.API.LogWarn("Failed to reply to post converted into a task", "post_id", post.Id, "error", appErr.Error())
+	}
+}
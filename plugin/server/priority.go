@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The priorities a task can have, from most to least important. Tasks without a priority rank
+// like P2.
+var taskPriorities = []string{"P0", "P1", "P2", "P3"}
+
+const defaultPriorityLevel = 2
+
+// parsePriority accepts a priority written as P1, p1 or 1. An empty value or "none" means no
+// priority.
+func parsePriority(value string) (string, bool) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" || value == "NONE" {
+		return "", true
+	}
+	if !strings.HasPrefix(value, "P") {
+		value = "P" + value
+	}
+	for _, priority := range taskPriorities {
+		if value == priority {
+			return priority, true
+		}
+	}
+	return "", false
+}
+
+// validatePriority normalizes the priority of a task sent by a client.
+func validatePriority(task *TaskItem) error {
+	priority, ok := parsePriority(task.Priority)
+	if !ok {
+		return &validationError{Field: "priority", Message: "must be one of P0, P1, P2 or P3, or empty"}
+	}
+	task.Priority = priority
+	return nil
+}
+
+// priorityLevel returns 0 for P0 up to 3 for P3.
+func priorityLevel(priority string) int {
+	for level, p := range taskPriorities {
+		if priority == p {
+			return level
+		}
+	}
+	return defaultPriorityLevel
+}
+
+// isHighPriority reports whether a task is P0 or P1.
+func isHighPriority(task TaskItem) bool {
+	return task.Priority != "" && priorityLevel(task.Priority) <= 1
+}
+
+// priorityBadge marks a task's priority in slash command output and messages from the bot.
+func priorityBadge(task TaskItem) string {
+	switch task.Priority {
+	case "P0":
+		return "🔴 **P0** "
+	case "P1":
+		return "🟠 **P1** "
+	case "":
+		return ""
+	default:
+		return fmt.Sprintf("**%s** ", task.Priority)
+	}
+}
+
+// deadlineUrgency returns 0 for overdue tasks, 1 for tasks due today, 2 for tasks due within a
+// week, 3 for later deadlines and 4 for tasks without one.
+func deadlineUrgency(task TaskItem, now time.Time) int {
+	if task.Deadline == nil {
+		return 4
+	}
+	todayStart := startOfDay(now)
+	deadline := localDeadline(*task.Deadline, now.Location())
+	switch {
+	case deadline.Before(todayStart):
+		return 0
+	case deadline.Before(todayStart.AddDate(0, 0, 1)):
+		return 1
+	case deadline.Before(todayStart.AddDate(0, 0, 7)):
+		return 2
+	default:
+		return 3
+	}
+}
+
+// taskRank blends priority and deadline urgency; lower ranks come first. A P0 task without a
+// deadline ranks with a P2 task due this week and ahead of an unprioritized task due later.
+func taskRank(task TaskItem, now time.Time) int {
+	return priorityLevel(task.Priority) + deadlineUrgency(task, now)
+}
+
+// rankedBefore orders two tasks by rank, then by deadline, then by priority, then by text.
+func rankedBefore(a, b TaskItem, now time.Time) bool {
+	if ra, rb := taskRank(a, now), taskRank(b, now); ra != rb {
+		return ra < rb
+	}
+	if a.Deadline != nil && b.Deadline != nil && !a.Deadline.Equal(*b.Deadline) {
+		return a.Deadline.Before(*b.Deadline)
+	}
+	if (a.Deadline == nil) != (b.Deadline == nil) {
+		return a.Deadline != nil
+	}
+	if la, lb := priorityLevel(a.Priority), priorityLevel(b.Priority); la != lb {
+		return la < lb
+	}
+	return a.Text < b.Text
+}
+
+// sortTasksByRank orders tasks with rankedBefore.
+func sortTasksByRank(tasks []TaskItem, now time.Time) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return rankedBefore(tasks[i], tasks[j], now)
+	})
+}
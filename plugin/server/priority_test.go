@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   string
+		wantOK bool
+	}{
+		{value: "", want: "", wantOK: true},
+		{value: "none", want: "", wantOK: true},
+		{value: "P0", want: "P0", wantOK: true},
+		{value: "p1", want: "P1", wantOK: true},
+		{value: " 2 ", want: "P2", wantOK: true},
+		{value: "3", want: "P3", wantOK: true},
+		{value: "P4"},
+		{value: "high"},
+		{value: "-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parsePriority(tt.value)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRankedBefore(t *testing.T) {
+	now := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	due := func(days int) *time.Time {
+		deadline := time.Date(2026, 10, 14+days, 0, 0, 0, 0, time.UTC)
+		return &deadline
+	}
+
+	tests := []struct {
+		name string
+		a, b TaskItem
+		want bool
+	}{
+		{
+			name: "overdue before due later",
+			a:    TaskItem{Text: "b", Deadline: due(-1)},
+			b:    TaskItem{Text: "a", Deadline: due(3)},
+			want: true,
+		},
+		{
+			name: "P0 without deadline ties with P2 due this week and wins on deadline",
+			a:    TaskItem{Text: "a", Priority: "P0"},
+			b:    TaskItem{Text: "b", Priority: "P2", Deadline: due(3)},
+			want: false,
+		},
+		{
+			name: "P0 without deadline before unprioritized task due later",
+			a:    TaskItem{Text: "b", Priority: "P0"},
+			b:    TaskItem{Text: "a", Deadline: due(30)},
+			want: true,
+		},
+		{
+			name: "same rank orders by deadline",
+			a:    TaskItem{Text: "b", Deadline: due(2)},
+			b:    TaskItem{Text: "a", Deadline: due(4)},
+			want: true,
+		},
+		{
+			name: "a high priority outranks a closer deadline",
+			a:    TaskItem{Text: "b", Priority: "P0", Deadline: due(30)},
+			b:    TaskItem{Text: "a", Deadline: due(2)},
+			want: true,
+		},
+		{
+			name: "a deadline today outranks a higher priority without one",
+			a:    TaskItem{Text: "a", Priority: "P1"},
+			b:    TaskItem{Text: "b", Priority: "P3", Deadline: due(0)},
+			want: false,
+		},
+		{
+			name: "no priority ranks like P2",
+			a:    TaskItem{Text: "b"},
+			b:    TaskItem{Text: "a", Priority: "P2"},
+			want: false,
+		},
+		{
+			name: "everything equal orders by text",
+			a:    TaskItem{Text: "a"},
+			b:    TaskItem{Text: "b"},
+			want: true,
+		},
+		{
+			name: "a task is not before itself",
+			a:    TaskItem{Text: "a", Priority: "P1", Deadline: due(1)},
+			b:    TaskItem{Text: "a", Priority: "P1", Deadline: due(1)},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, rankedBefore(tt.a, tt.b, now))
+		})
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+const (
+	// overdueNudgeWindow stops nudges about tasks that were already long overdue when the
+	// scheduler first saw them.
+	overdueNudgeWindow = 7 * 24 * time.Hour
+	// overdueReminder is the label recorded once the overdue nudge has been sent.
+	overdueReminder = "overdue"
+)
+
+// errNoRemindersDue aborts writing the reminder state of a task when nothing is due.
+var errNoRemindersDue = errors.New("no reminders due")
+
+// defaultReminderOffsets are used by users who have not chosen their own.
+var defaultReminderOffsets = []string{"1d", "1h"}
+
+var reminderOffsetPattern = regexp.MustCompile(`^(\d+)(m|h|d|w)$`)
+
+// parseReminderOffset parses an offset such as 30m, 2h, 1d or 1w, up to maxReminderOffset.
+func parseReminderOffset(value string) (time.Duration, bool) {
+	match := reminderOffsetPattern.FindStringSubmatch(strings.ToLower(value))
+	if match == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	unit := map[string]time.Duration{"m": time.Minute, "h": time.Hour, "d": 24 * time.Hour, "w": 7 * 24 * time.Hour}[match[2]]
+	offset := time.Duration(n) * unit
+	if offset/unit != time.Duration(n) || offset > maxReminderOffset {
+		return 0, false
+	}
+	return offset, true
+}
+
+// formatReminderOffset renders an offset for a message, e.g. "1 day" or "30 minutes".
+func formatReminderOffset(offset time.Duration) string {
+	units := []struct {
+		size time.Duration
+		name string
+	}{{7 * 24 * time.Hour, "week"}, {24 * time.Hour, "day"}, {time.Hour, "hour"}, {time.Minute, "minute"}}
+	for _, u := range units {
+		if offset >= u.size && offset%u.size == 0 {
+			n := int64(offset / u.size)
+			if n == 1 {
+				return "1 " + u.name
+			}
+			return fmt.Sprintf("%d %ss", n, u.name)
+		}
+	}
+	return offset.String()
+}
+
+// taskDueAt returns the moment a deadline passes for someone in loc. Deadlines picked as a date
+// last until the end of that day.
+func taskDueAt(deadline time.Time, loc *time.Location) time.Time {
+	local := localDeadline(deadline, loc)
+	if isDateOnly(deadline) {
+		return local.AddDate(0, 0, 1)
+	}
+	return local
+}
+
+// taskReminderState records the reminders sent for a task, per user, for one deadline. It is
+// reset when the deadline changes so a postponed task is reminded about again.
+type taskReminderState struct {
+	Deadline time.Time           `json:"deadline"`
+	Sent     map[string][]string `json:"sent"`
+}
+
+func (s *taskReminderState) wasSent(userID, label string) bool {
+	for _, sent := range s.Sent[userID] {
+		if sent == label {
+			return true
+		}
+	}
+	return false
+}
+
+func taskRemindersKey(taskID string) string {
+	return "reminders_" + taskID
+}
+
+// clearTaskReminders forgets the reminders sent for a task that no longer exists.
+func (p *Plugin) clearTaskReminders(taskID string) {
+	if appErr := p.API.KVDelete(taskRemindersKey(taskID)); appErr != nil {
+		p.API.LogWarn("Failed to clear task reminders", "task_id", taskID, "error", appErr.Error())
+	}
+}
+
+// maxReminderOffset is the earliest a reminder can be sent before a deadline. It bounds the days
+// of the deadline index the reminder job has to read.
+const maxReminderOffset = 4 * 7 * 24 * time.Hour
+
+// deadlineTasksPrefix starts the keys of the deadline index, which lists the open tasks that
+// have a deadline so the reminder job does not have to load every list on each run. The index
+// is split into one value per UTC day of the deadline, e.g. deadline_tasks_2024-05-31, so
+// writes for tasks due on different days do not contend and the job only reads the days it can
+// send reminders for.
+const deadlineTasksPrefix = "deadline_tasks_"
+
+func deadlineTasksKey(deadline time.Time) string {
+	return deadlineTasksPrefix + deadline.UTC().Format("2006-01-02")
+}
+
+// errDeadlineIndexUnchanged aborts a write to the deadline index that would change nothing.
+var errDeadlineIndexUnchanged = errors.New("deadline index unchanged")
+
+// hasOpenDeadline reports whether a task belongs in the deadline index. task is nil for tasks
+// that do not exist.
+func hasOpenDeadline(task *TaskItem) bool {
+	return task != nil && !task.Completed && task.Deadline != nil
+}
+
+// updateDeadlineIndex keeps the deadline index in step when a task is written. before is nil for
+// new tasks and after is nil for deleted ones.
+func (p *Plugin) updateDeadlineIndex(scope Scope, taskID string, before, after *TaskItem) {
+	var oldKey, newKey string
+	if hasOpenDeadline(before) {
+		oldKey = deadlineTasksKey(*before.Deadline)
+	}
+	if hasOpenDeadline(after) {
+		newKey = deadlineTasksKey(*after.Deadline)
+	}
+	if oldKey == newKey {
+		return
+	}
+
+	refs := map[string]taskRef{taskID: {ScopeKind: scope.Kind, ScopeID: scope.ID, TaskID: taskID}}
+	if oldKey != "" {
+		if err := p.setDeadlineTasks(oldKey, refs, false); err != nil {
+			p.API.LogWarn("Failed to update the deadline index", "task_id", taskID, "error", err.Error())
+		}
+	}
+	if newKey != "" {
+		if err := p.setDeadlineTasks(newKey, refs, true); err != nil {
+			p.API.LogWarn("Failed to update the deadline index", "task_id", taskID, "error", err.Error())
+		}
+	}
+}
+
+// setDeadlineTasks adds refs to one day of the deadline index, or removes them when add is
+// false.
+func (p *Plugin) setDeadlineTasks(key string, refs map[string]taskRef, add bool) error {
+	_, err := casUpdate(p, key, func(stored *[]taskRef, _ bool) error {
+		kept := []taskRef{}
+		for _, ref := range *stored {
+			if _, ok := refs[ref.TaskID]; !ok {
+				kept = append(kept, ref)
+			}
+		}
+		if !add && len(kept) == len(*stored) {
+			return errDeadlineIndexUnchanged
+		}
+		if add {
+			for _, ref := range refs {
+				kept = append(kept, ref)
+			}
+		}
+		*stored = kept
+		return nil
+	})
+	if errors.Is(err, errDeadlineIndexUnchanged) {
+		return nil
+	}
+	return err
+}
+
+// removeFromDeadlineIndex drops deleted tasks from the deadline index.
+func (p *Plugin) removeFromDeadlineIndex(scope Scope, tasks []TaskItem) {
+	byKey := make(map[string]map[string]taskRef)
+	for _, task := range tasks {
+		if !hasOpenDeadline(&task) {
+			continue
+		}
+		key := deadlineTasksKey(*task.Deadline)
+		if byKey[key] == nil {
+			byKey[key] = make(map[string]taskRef)
+		}
+		byKey[key][task.ID] = taskRef{ScopeKind: scope.Kind, ScopeID: scope.ID, TaskID: task.ID}
+	}
+	for key, refs := range byKey {
+		if err := p.setDeadlineTasks(key, refs, false); err != nil {
+			p.API.LogWarn("Failed to remove deleted tasks from the deadline index", "key", key, "error", err.Error())
+		}
+	}
+}
+
+// runReminderJob sends the deadline reminders that are due. It runs on one node at a time, see
+// runScheduledJobs.
+//
+// It reads the days of the deadline index that can hold a task due for a reminder: from the
+// overdue nudge window up to maxReminderOffset ahead, with a day of margin on each side for
+// dates that end later or earlier than UTC midnight. The day that has just left the window is
+// deleted. Tasks that have been completed, deleted or rescheduled without the index noticing
+// are dropped from it.
+func (p *Plugin) runReminderJob(now time.Time) {
+	today := startOfDay(now.UTC())
+	first := today.Add(-overdueNudgeWindow).AddDate(0, 0, -2)
+	last := today.Add(maxReminderOffset).AddDate(0, 0, 1)
+
+	if appErr := p.API.KVDelete(deadlineTasksKey(first.AddDate(0, 0, -1))); appErr != nil {
+		p.API.LogWarn("Failed to delete an expired day of the deadline index", "error", appErr.Error())
+	}
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		p.sendRemindersForDay(deadlineTasksKey(day), now)
+	}
+}
+
+// sendRemindersForDay sends the reminders for the tasks in one day of the deadline index.
+func (p *Plugin) sendRemindersForDay(key string, now time.Time) {
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		p.API.LogError("Failed to load the deadline index", "key", key, "error", appErr.Error())
+		return
+	}
+	if data == nil {
+		return
+	}
+	var refs []taskRef
+	if err := p.unmarshalValue(key, data, &refs); err != nil {
+		return
+	}
+
+	privateEnabled := p.getConfiguration().EnablePrivateTasks
+	stale := make(map[string]taskRef)
+	for _, ref := range refs {
+		scope := ref.scope()
+		if scope.IsPrivate() && !privateEnabled {
+			continue
+		}
+		task, err := p.getTask(scope.listKey(), ref.TaskID)
+		if err != nil {
+			p.API.LogWarn("Failed to load task for reminders", "task_id", ref.TaskID, "error", err.Error())
+			continue
+		}
+		if !hasOpenDeadline(task) || deadlineTasksKey(*task.Deadline) != key {
+			stale[ref.TaskID] = ref
+			continue
+		}
+		p.sendTaskReminders(scope, *task, now)
+	}
+
+	if len(stale) == 0 {
+		return
+	}
+	if err := p.setDeadlineTasks(key, stale, false); err != nil {
+		p.API.LogWarn("Failed to drop stale entries from the deadline index", "key", key, "error", err.Error())
+		return
+	}
+	// A task that was rescheduled, reopened or given a deadline again since it was read is
+	// put back under its current day.
+	for taskID, ref := range stale {
+		if task, err := p.getTask(ref.scope().listKey(), taskID); err == nil && hasOpenDeadline(task) {
+			p.updateDeadlineIndex(ref.scope(), taskID, nil, task)
+		}
+	}
+}
+
+// scopeForIndexKey returns the scope whose index is stored under key.
+func scopeForIndexKey(key string) (Scope, bool) {
+	id := strings.TrimSuffix(key, "_index")
+	for _, kind := range []ScopeKind{ScopePrivate, ScopeChannel} {
+		prefix := Scope{Kind: kind}.listKey()
+		if strings.HasPrefix(id, prefix) {
+			return Scope{Kind: kind, ID: strings.TrimPrefix(id, prefix)}, true
+		}
+	}
+	return Scope{}, false
+}
+
+// sendTaskReminders sends each recipient of a task the reminder that is due for them, if any:
+// the closest of their offsets that has been reached, or the overdue nudge.
+func (p *Plugin) sendTaskReminders(scope Scope, task TaskItem, now time.Time) {
+	recipients := task.AssigneeIDs
+	if scope.IsPrivate() {
+		recipients = []string{scope.ID}
+	} else {
+		// Assignees who have left the channel are not reminded of its tasks.
+		recipients = p.filterChannelMembers(scope.ID, recipients)
+	}
+	if len(recipients) == 0 {
+		return
+	}
+
+	// The state is written before the messages are sent so that a failed write never leads to
+	// a reminder being sent twice.
+	var messages map[string]string
+	_, err := casUpdate(p, taskRemindersKey(task.ID), func(state *taskReminderState, _ bool) error {
+		messages = make(map[string]string)
+		if !state.Deadline.Equal(*task.Deadline) || state.Sent == nil {
+			state.Deadline = *task.Deadline
+			state.Sent = make(map[string][]string)
+		}
+		changed := false
+		for _, userID := range recipients {
+			labels, message, err := p.dueReminder(scope, task, userID, now, state)
+			if err != nil {
+				return err
+			}
+			if len(labels) == 0 {
+				continue
+			}
+			changed = true
+			state.Sent[userID] = append(state.Sent[userID], labels...)
+			if message != "" {
+				messages[userID] = message
+			}
+		}
+		if !changed {
+			return errNoRemindersDue
+		}
+		return nil
+	})
+	if errors.Is(err, errNoRemindersDue) {
+		return
+	}
+	if err != nil {
+		p.API.LogWarn("Failed to record task reminders", "task_id", task.ID, "error", err.Error())
+		return
+	}
+
+	for userID, message := range messages {
+		if err := p.sendDirectMessage(userID, message); err != nil {
+			p.API.LogWarn("Failed to send task reminder", "user_id", userID, "task_id", task.ID, "error", err.Error())
+		}
+	}
+}
+
+// dueReminder returns the reminder labels to record for a user and the message to send. Offsets
+// that were skipped because a closer one was reached are recorded without a message. Nothing is
+// recorded for the task when the message cannot be rendered, so it is tried again on the next
+// run.
+func (p *Plugin) dueReminder(scope Scope, task TaskItem, userID string, now time.Time, state *taskReminderState) ([]string, string, error) {
+	if state.wasSent(userID, overdueReminder) {
+		return nil, "", nil
+	}
+	prefs := p.getUserNotificationPrefs(userID)
+	if prefs.RemindersOff {
+		return nil, "", nil
+	}
+
+	now = now.In(p.userLocation(userID))
+	dueAt := taskDueAt(*task.Deadline, now.Location())
+	if now.After(dueAt.Add(overdueNudgeWindow)) {
+		return nil, "", nil
+	}
+	if !now.Before(dueAt) {
+		message, err := p.reminderMessage(scope, task, userID, now, 0)
+		return []string{overdueReminder}, message, err
+	}
+
+	offsets := prefs.ReminderOffsets
+	if len(offsets) == 0 {
+		offsets = defaultReminderOffsets
+	}
+
+	var labels []string
+	var closest time.Duration
+	for _, label := range offsets {
+		offset, ok := parseReminderOffset(label)
+		if !ok || state.wasSent(userID, label) || now.Before(dueAt.Add(-offset)) {
+			continue
+		}
+		labels = append(labels, label)
+		if closest == 0 || offset < closest {
+			closest = offset
+		}
+	}
+	if len(labels) == 0 {
+		return nil, "", nil
+	}
+	message, err := p.reminderMessage(scope, task, userID, now, closest)
+	return labels, message, err
+}
+
+// reminderMessage renders a reminder that a task is due within offset, or is overdue when offset
+// is zero. now is in the user's time zone.
+func (p *Plugin) reminderMessage(scope Scope, task TaskItem, userID string, now time.Time, offset time.Duration) (string, error) {
+	where := "your private tasks"
+	command := "/tasks private"
+	if !scope.IsPrivate() {
+		channel, appErr := p.API.GetChannel(scope.ID)
+		if appErr != nil {
+			return "", appErr
+		}
+		where = channelReference(channel)
+		command = "/tasks"
+	}
+
+	var sb strings.Builder
+	if offset == 0 {
+		sb.WriteString(fmt.Sprintf("🟥 %s**%s** in %s is past due |%s", taskNumberLabel(task), task.Text, where, p.formatDeadline(task.Deadline, now)))
+	} else {
+		sb.WriteString(fmt.Sprintf("⏰ %s**%s** in %s is due within %s |%s", taskNumberLabel(task), task.Text, where, formatReminderOffset(offset), p.formatDeadline(task.Deadline, now)))
+	}
+	sb.WriteString(p.formatTaskLink(task, userID, now.Location()))
+	if task.Number != 0 {
+		sb.WriteString(fmt.Sprintf("\nUse `%s done %d` when it's finished or `%s due %d <day>` to move it.", command, task.Number, command, task.Number))
+	}
+	sb.WriteString("\n_Use `/tasks notify reminders off` to stop deadline reminders._")
+	return sb.String(), nil
+}
+
+// handleRemindersCommand runs `/tasks notify reminders on|off|<offsets>`.
+func (p *Plugin) handleRemindersCommand(args *model.CommandArgs, words []string) *model.CommandResponse {
+	usage := "❌ Usage: `/tasks notify reminders on`, `/tasks notify reminders off` or `/tasks notify reminders 1d 1h` (offsets in m, h, d or w before the deadline, up to 4w)"
+	if len(words) == 0 {
+		return ephemeralResponse(usage)
+	}
+
+	prefs := p.getUserNotificationPrefs(args.UserId)
+	switch words[0] {
+	case "on":
+		prefs.RemindersOff = false
+	case "off":
+		prefs.RemindersOff = true
+	default:
+		var offsets []string
+		seen := make(map[time.Duration]bool)
+		for _, word := range words {
+			for _, value := range strings.Split(word, ",") {
+				if value == "" {
+					continue
+				}
+				offset, ok := parseReminderOffset(value)
+				if !ok {
+					return ephemeralResponse(usage)
+				}
+				if !seen[offset] {
+					seen[offset] = true
+					offsets = append(offsets, strings.ToLower(value))
+				}
+			}
+		}
+		sort.Slice(offsets, func(i, j int) bool {
+			a, _ := parseReminderOffset(offsets[i])
+			b, _ := parseReminderOffset(offsets[j])
+			return a > b
+		})
+		prefs.RemindersOff = false
+		prefs.ReminderOffsets = offsets
+	}
+
+	if err := p.saveUserNotificationPrefs(args.UserId, prefs); err != nil {
+		p.API.LogError("Failed to save notification preferences", "user_id", args.UserId, "error", err.Error())
+		return ephemeralResponse("❌ Error saving your preference. Please try again.")
+	}
+	if prefs.RemindersOff {
+		return ephemeralResponse("🔕 You will no longer get deadline reminders.")
+	}
+
+	offsets := prefs.ReminderOffsets
+	if len(offsets) == 0 {
+		offsets = defaultReminderOffsets
+	}
+	labels := make([]string, 0, len(offsets))
+	for _, label := range offsets {
+		offset, _ := parseReminderOffset(label)
+		labels = append(labels, formatReminderOffset(offset))
+	}
+	return ephemeralResponse(fmt.Sprintf("⏰ You will be reminded %s before a deadline, and once a task is past due.", strings.Join(labels, " and ")))
+}
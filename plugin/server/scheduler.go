@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-api/cluster"
+)
+
+const (
+	// schedulerInterval is how often the scheduler looks for reminders, summaries and digests to
+	// send.
+	schedulerInterval = 5 * time.Minute
+	// trashPurgeInterval is how often deleted tasks past the retention period are purged. The
+	// retention period is set in days, so once a day is enough.
+	trashPurgeInterval = 24 * time.Hour
+
+	// The names of the cluster jobs, each of which runs on one node at a time.
+	schedulerJobKey  = "scheduled_jobs"
+	trashPurgeJobKey = "trash_purge"
+)
+
+// startScheduler starts the cluster jobs that run the scheduled jobs every schedulerInterval and
+// purge the trash every trashPurgeInterval, until stopScheduler is called.
+func (p *Plugin) startScheduler() error {
+	job, err := cluster.Schedule(p.API, schedulerJobKey, cluster.MakeWaitForInterval(schedulerInterval), func() {
+		p.runScheduledJobs(time.Now())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule jobs: %w", err)
+	}
+	p.jobs = append(p.jobs, job)
+
+	job, err = cluster.Schedule(p.API, trashPurgeJobKey, cluster.MakeWaitForInterval(trashPurgeInterval), func() {
+		p.runTrashPurgeJob(time.Now())
+	})
+	if err != nil {
+		p.stopScheduler()
+		return fmt.Errorf("failed to schedule trash purge: %w", err)
+	}
+	p.jobs = append(p.jobs, job)
+	return nil
+}
+
+func (p *Plugin) stopScheduler() {
+	for _, job := range p.jobs {
+		if err := job.Close(); err != nil {
+			p.API.LogWarn("Failed to stop a scheduled job", "error", err.Error())
+		}
+	}
+	p.jobs = nil
+}
+
+// runScheduledJobs sends the deadline reminders, daily summaries and channel digests that are due.
+// The cluster job started by startScheduler runs it on one node at a time.
+func (p *Plugin) runScheduledJobs(now time.Time) {
+	p.runReminderJob(now)
+	p.runDailySummaryJob()
+	p.runDigestJob()
+}
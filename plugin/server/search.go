@@ -0,0 +1,399 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// taskQuery is a parsed search query. Every condition that is set must match; repeated
+// conditions of the same kind (two text terms, two assignees) must all match as well.
+type taskQuery struct {
+	Terms       []string
+	AssigneeIDs []string
+	Unassigned  bool
+	Groups      []string
+	Channels    []string
+	Open        *bool
+	Private     *bool
+	Overdue     bool
+	NoDeadline  bool
+	HasDeadline bool
+	// DueFrom and DueUntil bound the deadline: DueFrom inclusive, DueUntil exclusive.
+	DueFrom  *time.Time
+	DueUntil *time.Time
+}
+
+// queryError is returned for a search query that cannot be parsed.
+type queryError struct {
+	Token   string
+	Message string
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Token, e.Message)
+}
+
+// tokenizeQuery splits a query on whitespace, keeping double-quoted parts together and
+// removing the quotes, so `group:"Release 2"` is one token with the value `Release 2`.
+func tokenizeQuery(input string) ([]string, error) {
+	var tokens []string
+	var current strings.Builder
+	inQuotes, started := false, false
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			started = true
+		case !inQuotes && (r == ' ' || r == '\t' || r == '\n'):
+			if started {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+	if inQuotes {
+		return nil, &queryError{Token: input, Message: "unterminated quote"}
+	}
+	if started {
+		tokens = append(tokens, current.String())
+	}
+	return tokens, nil
+}
+
+// parseTaskQuery parses the search syntax, for example
+// `assignee:@alice due:<2026-11-01 group:"Release" is:open text:deploy`. Words without a
+// qualifier are text terms. lookupUser resolves a username to a user ID; "me" refers to userID.
+func parseTaskQuery(input, userID string, now time.Time, lookupUser func(username string) (string, error)) (*taskQuery, error) {
+	tokens, err := tokenizeQuery(input)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &taskQuery{}
+	for _, token := range tokens {
+		key, value, qualified := strings.Cut(token, ":")
+		if !qualified {
+			q.Terms = append(q.Terms, strings.ToLower(token))
+			continue
+		}
+		if value == "" {
+			return nil, &queryError{Token: token, Message: "missing value"}
+		}
+
+		switch strings.ToLower(key) {
+		case "text":
+			q.Terms = append(q.Terms, strings.ToLower(value))
+		case "assignee":
+			switch name := strings.TrimPrefix(value, "@"); strings.ToLower(name) {
+			case "me":
+				q.AssigneeIDs = append(q.AssigneeIDs, userID)
+			case "none":
+				q.Unassigned = true
+			default:
+				id, err := lookupUser(name)
+				if err != nil {
+					return nil, &queryError{Token: token, Message: "unknown user"}
+				}
+				q.AssigneeIDs = append(q.AssigneeIDs, id)
+			}
+		case "group":
+			q.Groups = append(q.Groups, strings.ToLower(value))
+		case "channel", "in":
+			q.Channels = append(q.Channels, strings.ToLower(strings.TrimPrefix(value, "~")))
+		case "is":
+			yes, no := true, false
+			switch strings.ToLower(value) {
+			case "open", "incomplete":
+				q.Open = &yes
+			case "done", "complete", "completed", "closed":
+				q.Open = &no
+			case "private":
+				q.Private = &yes
+			case "channel":
+				q.Private = &no
+			case "overdue":
+				q.Overdue = true
+			default:
+				return nil, &queryError{Token: token, Message: "expected open, done, private, channel or overdue"}
+			}
+		case "due":
+			if err := q.parseDue(value, now); err != nil {
+				return nil, &queryError{Token: token, Message: err.Error()}
+			}
+		default:
+			// Not a known qualifier, so the colon is part of the text, e.g. "v2:beta".
+			q.Terms = append(q.Terms, strings.ToLower(token))
+		}
+	}
+	return q, nil
+}
+
+// parseDue handles due:none, due:any, due:<day, due:<=day, due:>day, due:>=day and due:day.
+func (q *taskQuery) parseDue(value string, now time.Time) error {
+	switch strings.ToLower(value) {
+	case "none":
+		q.NoDeadline = true
+		return nil
+	case "any":
+		q.HasDeadline = true
+		return nil
+	}
+
+	op := ""
+	for _, candidate := range []string{"<=", ">=", "<", ">"} {
+		if strings.HasPrefix(value, candidate) {
+			op = candidate
+			value = strings.TrimPrefix(value, candidate)
+			break
+		}
+	}
+
+	dayStart, ok := parseDay(value, now)
+	if !ok {
+		return fmt.Errorf("expected a date such as 2026-11-01, today, tomorrow or friday")
+	}
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	switch op {
+	case "<":
+		q.DueUntil = &dayStart
+	case "<=":
+		q.DueUntil = &dayEnd
+	case ">":
+		q.DueFrom = &dayEnd
+	case ">=":
+		q.DueFrom = &dayStart
+	default:
+		q.DueFrom, q.DueUntil = &dayStart, &dayEnd
+	}
+	return nil
+}
+
+// parseDay returns the start of the day named by value: an ISO date, "today", "tomorrow",
+// "yesterday", "next week", "in 3 days", "in 2 weeks" or a weekday name, optionally preceded by
+// "next", which means the next such day after today.
+func parseDay(value string, now time.Time) (time.Time, bool) {
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	value = strings.Join(strings.Fields(strings.ToLower(value)), " ")
+	switch value {
+	case "today":
+		return todayStart, true
+	case "tomorrow":
+		return todayStart.AddDate(0, 0, 1), true
+	case "yesterday":
+		return todayStart.AddDate(0, 0, -1), true
+	case "next week":
+		return todayStart.AddDate(0, 0, 7), true
+	}
+
+	var count int
+	var unit string
+	if n, _ := fmt.Sscanf(value, "in %d %s", &count, &unit); n == 2 && count >= 0 {
+		switch strings.TrimSuffix(unit, "s") {
+		case "day":
+			return todayStart.AddDate(0, 0, count), true
+		case "week":
+			return todayStart.AddDate(0, 0, 7*count), true
+		}
+	}
+	value = strings.TrimPrefix(value, "next ")
+
+	for offset := 1; offset <= 7; offset++ {
+		day := todayStart.AddDate(0, 0, offset)
+		name := strings.ToLower(day.Weekday().String())
+		if value == name || value == name[:3] {
+			return day, true
+		}
+	}
+
+	if day, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return day, true
+	}
+	return time.Time{}, false
+}
+
+// matches reports whether a task satisfies every condition of the query.
+func (q *taskQuery) matches(t TaskWithContext, now time.Time) bool {
+	task := t.Task
+	var deadline time.Time
+	if task.Deadline != nil {
+		deadline = localDeadline(*task.Deadline, now.Location())
+	}
+
+	for _, term := range q.Terms {
+		if !strings.Contains(strings.ToLower(task.Text), term) && !strings.Contains(strings.ToLower(task.Notes), term) {
+			return false
+		}
+	}
+	for _, id := range q.AssigneeIDs {
+		if !isAssignedTo(task, id) {
+			return false
+		}
+	}
+	if q.Unassigned && len(task.AssigneeIDs) > 0 {
+		return false
+	}
+	for _, group := range q.Groups {
+		if strings.ToLower(t.GroupName) != group {
+			return false
+		}
+	}
+	// The channel names themselves are matched by matchesChannel before the lists are loaded.
+	if len(q.Channels) > 0 && t.IsPrivate {
+		return false
+	}
+	if q.Open != nil && task.Completed == *q.Open {
+		return false
+	}
+	if q.Private != nil && t.IsPrivate != *q.Private {
+		return false
+	}
+	if q.Overdue && (task.Completed || task.Deadline == nil || !deadline.Before(startOfDay(now))) {
+		return false
+	}
+	if q.NoDeadline && task.Deadline != nil {
+		return false
+	}
+	if (q.HasDeadline || q.DueFrom != nil || q.DueUntil != nil) && task.Deadline == nil {
+		return false
+	}
+	if q.DueFrom != nil && deadline.Before(*q.DueFrom) {
+		return false
+	}
+	if q.DueUntil != nil && !deadline.Before(*q.DueUntil) {
+		return false
+	}
+	return true
+}
+
+// matchesChannel reports whether a channel satisfies the channel: conditions, which accept the
+// display name or the handle.
+func (q *taskQuery) matchesChannel(channel *model.Channel) bool {
+	for _, name := range q.Channels {
+		if strings.ToLower(channel.DisplayName) != name && strings.ToLower(channel.Name) != name {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Plugin) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Header.Get("Mattermost-User-Id")
+	rawQuery := r.URL.Query().Get("q")
+
+	query, err := parseTaskQuery(rawQuery, userID, p.userNow(userID), func(username string) (string, error) {
+		user, appErr := p.API.GetUserByUsername(username)
+		if appErr != nil {
+			return "", appErr
+		}
+		return user.Id, nil
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_query", err.Error())
+		return
+	}
+
+	results, err := p.searchTasks(userID, query)
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Query   string            `json:"query"`
+		Results []TaskWithContext `json:"results"`
+	}{Query: rawQuery, Results: results})
+}
+
+// searchTasks returns the tasks matching the query from every channel the user is a member of
+// and from their private list, ordered by deadline.
+func (p *Plugin) searchTasks(userID string, query *taskQuery) ([]TaskWithContext, error) {
+	var candidates []TaskWithContext
+
+	if query.Private == nil || !*query.Private {
+		channels, appErr := p.API.GetChannelsForTeamForUser("", userID, false)
+		if appErr != nil {
+			return nil, appErr
+		}
+		for _, channel := range channels {
+			if !query.matchesChannel(channel) {
+				continue
+			}
+			list, err := p.store.GetList(ChannelScope(channel.Id))
+			if err != nil {
+				p.API.LogError("Failed to load channel tasks for search", "channel_id", channel.Id, "error", err.Error())
+				continue
+			}
+			candidates = append(candidates, tasksWithContext(list, channel.Id, channel.DisplayName, false)...)
+		}
+	}
+
+	if (query.Private == nil || *query.Private) && p.getConfiguration().EnablePrivateTasks {
+		list, err := p.store.GetList(PrivateScope(userID))
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, tasksWithContext(list, "", "Private Tasks", true)...)
+	}
+
+	now := p.userNow(userID)
+	results := []TaskWithContext{}
+	for _, t := range candidates {
+		if query.matches(t, now) {
+			results = append(results, t)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		di, dj := results[i].Task.Deadline, results[j].Task.Deadline
+		if di != nil && dj != nil && !di.Equal(*dj) {
+			return di.Before(*dj)
+		}
+		if (di == nil) != (dj == nil) {
+			return di != nil
+		}
+		if results[i].ChannelName != results[j].ChannelName {
+			return results[i].ChannelName < results[j].ChannelName
+		}
+		return results[i].Task.Text < results[j].Task.Text
+	})
+	return results, nil
+}
+
+// tasksWithContext attaches the group and channel names to every task of a list.
+func tasksWithContext(list *ChannelTaskList, channelID, channelName string, isPrivate bool) []TaskWithContext {
+	groupMap := make(map[string]string)
+	for _, g := range list.Groups {
+		groupMap[g.ID] = g.Name
+	}
+
+	result := make([]TaskWithContext, 0, len(list.Items))
+	for _, task := range list.Items {
+		result = append(result, TaskWithContext{
+			Task:        task,
+			GroupName:   groupMap[task.GroupID],
+			ChannelID:   channelID,
+			ChannelName: channelName,
+			IsPrivate:   isPrivate,
+		})
+	}
+	return result
+}
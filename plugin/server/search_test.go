@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenizeQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", input: "", want: nil},
+		{name: "words", input: "deploy  release\tnotes", want: []string{"deploy", "release", "notes"}},
+		{name: "quoted value", input: `group:"Release 2" is:open`, want: []string{"group:Release 2", "is:open"}},
+		{name: "quoted phrase", input: `"release notes"`, want: []string{"release notes"}},
+		{name: "empty quotes", input: `text:""`, want: []string{"text:"}},
+		{name: "unterminated quote", input: `group:"Release`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tokenizeQuery(tt.input)
+			if tt.wantErr {
+				var qerr *queryError
+				assert.True(t, errors.As(err, &qerr))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseTaskQuery(t *testing.T) {
+	now := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	at := func(month time.Month, d int) *time.Time {
+		day := time.Date(2026, month, d, 0, 0, 0, 0, time.UTC)
+		return &day
+	}
+	yes, no := true, false
+	lookupUser := func(username string) (string, error) {
+		if username == "alice" {
+			return "alice-id", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    *taskQuery
+		wantErr string
+	}{
+		{
+			name:  "text terms",
+			input: "Deploy text:Notes v2:beta",
+			want:  &taskQuery{Terms: []string{"deploy", "notes", "v2:beta"}},
+		},
+		{
+			name:  "assignees",
+			input: "assignee:@alice assignee:me assignee:none",
+			want:  &taskQuery{AssigneeIDs: []string{"alice-id", "me-id"}, Unassigned: true},
+		},
+		{
+			name:  "groups and channels",
+			input: `group:"Release 2" in:~Town-Square channel:dev`,
+			want:  &taskQuery{Groups: []string{"release 2"}, Channels: []string{"town-square", "dev"}},
+		},
+		{
+			name:  "states",
+			input: "is:done is:private is:overdue",
+			want:  &taskQuery{Open: &no, Private: &yes, Overdue: true},
+		},
+		{
+			name:  "open channel tasks",
+			input: "is:open is:channel",
+			want:  &taskQuery{Open: &yes, Private: &no},
+		},
+		{
+			name:  "due on a day",
+			input: "due:tomorrow",
+			want:  &taskQuery{DueFrom: at(10, 15), DueUntil: at(10, 16)},
+		},
+		{
+			name:  "due before a day",
+			input: "due:<2026-11-01",
+			want:  &taskQuery{DueUntil: at(11, 1)},
+		},
+		{
+			name:  "due up to a day",
+			input: "due:<=2026-11-01",
+			want:  &taskQuery{DueUntil: at(11, 2)},
+		},
+		{
+			name:  "due after a day",
+			input: "due:>friday",
+			want:  &taskQuery{DueFrom: at(10, 17)},
+		},
+		{
+			name:  "due from a day",
+			input: "due:>=friday",
+			want:  &taskQuery{DueFrom: at(10, 16)},
+		},
+		{
+			name:  "with and without deadline",
+			input: "due:none due:any",
+			want:  &taskQuery{NoDeadline: true, HasDeadline: true},
+		},
+		{name: "missing value", input: "group:", wantErr: "missing value"},
+		{name: "unknown user", input: "assignee:@bob", wantErr: "unknown user"},
+		{name: "unknown state", input: "is:blocked", wantErr: "expected open, done"},
+		{name: "bad date", input: "due:<someday", wantErr: "expected a date"},
+		{name: "unterminated quote", input: `"deploy`, wantErr: "unterminated quote"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTaskQuery(tt.input, "me-id", now, lookupUser)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseDay(t *testing.T) {
+	// A Wednesday, late in the evening in UTC-5.
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	now := time.Date(2026, 10, 14, 23, 30, 0, 0, loc)
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2026, month, d, 0, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		value  string
+		want   time.Time
+		wantOK bool
+	}{
+		{value: "today", want: day(10, 14), wantOK: true},
+		{value: "Tomorrow", want: day(10, 15), wantOK: true},
+		{value: "yesterday", want: day(10, 13), wantOK: true},
+		{value: "next  week", want: day(10, 21), wantOK: true},
+		{value: "in 3 days", want: day(10, 17), wantOK: true},
+		{value: "in 1 day", want: day(10, 15), wantOK: true},
+		{value: "in 2 weeks", want: day(10, 28), wantOK: true},
+		{value: "in 0 days", want: day(10, 14), wantOK: true},
+		{value: "friday", want: day(10, 16), wantOK: true},
+		{value: "mon", want: day(10, 19), wantOK: true},
+		{value: "next tuesday", want: day(10, 20), wantOK: true},
+		// The same weekday as today means next week's.
+		{value: "wednesday", want: day(10, 21), wantOK: true},
+		{value: "2026-11-01", want: day(11, 1), wantOK: true},
+		{value: "in -1 days"},
+		{value: "in 3 months"},
+		{value: "2026-13-01"},
+		{value: "someday"},
+		{value: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseDay(tt.value, now)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.True(t, tt.want.Equal(got), "got %s, want %s", got, tt.want)
+				assert.Equal(t, loc, got.Location())
+			}
+		})
+	}
+}
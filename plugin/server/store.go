@@ -0,0 +1,345 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kvMaxRetries is how many times a task list mutation is re-applied when another writer
+// changed the list between our read and our compare-and-set.
+const kvMaxRetries = 8
+
+var (
+	errTaskListConflict = errors.New("task list is being modified concurrently, please retry")
+	errTaskNotFound     = errors.New("task not found")
+	errGroupNotFound    = errors.New("group not found")
+	// errTaskUnchanged aborts writing a task that a mutation would leave as it is.
+	errTaskUnchanged = errors.New("task unchanged")
+)
+
+// staleError is returned when a conditional write targets a task or group that has changed
+// since the client read it. Current holds the stored copy so it can be sent back to the client.
+type staleError struct {
+	Current interface{}
+	Version int64
+}
+
+func (e *staleError) Error() string {
+	return "the entity has been modified since it was read"
+}
+
+// taskListIndex is the lightweight per-list record stored next to the individual tasks. It keeps
+// the groups and the order of the task IDs; each task lives under its own key.
+type taskListIndex struct {
+	TaskIDs         []string    `json:"task_ids"`
+	Groups          []TaskGroup `json:"groups"`
+	HasEverHadTasks bool        `json:"has_ever_had_tasks"`
+	// LastNumber is the highest task number handed out in this list. Numbers are never reused,
+	// so a number keeps referring to the same task after others are deleted.
+	LastNumber int64 `json:"last_number"`
+}
+
+// A task list is identified by its list key (see Scope.listKey). The index and the tasks are
+// stored under keys derived from it.
+func taskIndexKey(listKey string) string {
+	return listKey + "_index"
+}
+
+func taskItemKey(listKey, taskID string) string {
+	return listKey + "_task_" + taskID
+}
+
+// casUpdate reads the JSON value stored under key, applies fn to it and writes it back with
+// KVCompareAndSet. If the stored value changed in the meantime the read-modify-write is retried,
+// so fn must only depend on the value it is given. When the retry budget is exhausted
+// errTaskListConflict is returned. Errors returned by fn abort the update without writing.
+func casUpdate[T any](p *Plugin, key string, fn func(value *T, exists bool) error) (*T, error) {
+	for attempt := 0; attempt < kvMaxRetries; attempt++ {
+		oldData, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			return nil, appErr
+		}
+
+		value := new(T)
+		if oldData != nil {
+			if err := p.unmarshalValue(key, oldData, value); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := fn(value, oldData != nil); err != nil {
+			return nil, err
+		}
+
+		newData, err := marshalValue(value)
+		if err != nil {
+			return nil, err
+		}
+
+		saved, appErr := p.API.KVCompareAndSet(key, oldData, newData)
+		if appErr != nil {
+			return nil, appErr
+		}
+		if saved {
+			return value, nil
+		}
+
+		// Someone else wrote the value first; back off a little before re-reading it.
+		time.Sleep(time.Duration(attempt+1)*10*time.Millisecond + time.Duration(rand.Intn(10))*time.Millisecond)
+	}
+
+	p.API.LogWarn("Gave up writing task data after concurrent modifications", "key", key, "attempts", kvMaxRetries)
+	return nil, errTaskListConflict
+}
+
+// loadTaskIndex returns the index of a list, migrating a legacy single-blob list first if needed.
+func (p *Plugin) loadTaskIndex(listKey string) (*taskListIndex, error) {
+	data, appErr := p.API.KVGet(taskIndexKey(listKey))
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if data == nil {
+		if err := p.migrateLegacyTaskList(listKey); err != nil {
+			return nil, err
+		}
+		if data, appErr = p.API.KVGet(taskIndexKey(listKey)); appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	index := &taskListIndex{}
+	if data != nil {
+		if err := p.unmarshalValue(taskIndexKey(listKey), data, index); err != nil {
+			return nil, err
+		}
+	}
+	if index.TaskIDs == nil {
+		index.TaskIDs = []string{}
+	}
+	if index.Groups == nil {
+		index.Groups = []TaskGroup{}
+	}
+	return index, nil
+}
+
+// loadTaskList assembles the full list from its index and task keys. IDs whose task key is gone
+// (a delete that was interrupted half way) are skipped.
+func (p *Plugin) loadTaskList(listKey string) (*ChannelTaskList, error) {
+	index, err := p.loadTaskIndex(listKey)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &ChannelTaskList{
+		Items:           make([]TaskItem, 0, len(index.TaskIDs)),
+		Groups:          index.Groups,
+		HasEverHadTasks: index.HasEverHadTasks,
+	}
+	for _, taskID := range index.TaskIDs {
+		data, appErr := p.API.KVGet(taskItemKey(listKey, taskID))
+		if appErr != nil {
+			return nil, appErr
+		}
+		if data == nil {
+			continue
+		}
+
+		var task TaskItem
+		if err := p.unmarshalValue(taskItemKey(listKey, taskID), data, &task); err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, task)
+	}
+	return list, nil
+}
+
+// mutateIndex applies fn to the index of a list with compare-and-set.
+func (p *Plugin) mutateIndex(listKey string, fn func(index *taskListIndex) error) (*taskListIndex, error) {
+	if _, err := p.loadTaskIndex(listKey); err != nil {
+		return nil, err
+	}
+
+	return casUpdate(p, taskIndexKey(listKey), func(index *taskListIndex, _ bool) error {
+		if index.TaskIDs == nil {
+			index.TaskIDs = []string{}
+		}
+		if index.Groups == nil {
+			index.Groups = []TaskGroup{}
+		}
+		return fn(index)
+	})
+}
+
+// allocateTaskNumber reserves the next task number of a list.
+func (p *Plugin) allocateTaskNumber(listKey string) (int64, error) {
+	index, err := p.mutateIndex(listKey, func(index *taskListIndex) error {
+		index.LastNumber++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return index.LastNumber, nil
+}
+
+// insertTask stores a new task and appends it to the index of the list.
+func (p *Plugin) insertTask(listKey string, task TaskItem) error {
+	if _, err := casUpdate(p, taskItemKey(listKey, task.ID), func(stored *TaskItem, exists bool) error {
+		if exists {
+			return fmt.Errorf("task %s already exists", task.ID)
+		}
+		*stored = task
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if _, err := p.mutateIndex(listKey, func(index *taskListIndex) error {
+		index.TaskIDs = append(index.TaskIDs, task.ID)
+		index.HasEverHadTasks = true
+		return nil
+	}); err != nil {
+		p.API.KVDelete(taskItemKey(listKey, task.ID))
+		return err
+	}
+	return nil
+}
+
+// mutateTask applies fn to a single task with compare-and-set. The index is passed along so fn
+// can validate references such as the group ID; it is not written.
+func (p *Plugin) mutateTask(listKey, taskID string, fn func(task *TaskItem, index *taskListIndex) error) (*TaskItem, error) {
+	index, err := p.loadTaskIndex(listKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return casUpdate(p, taskItemKey(listKey, taskID), func(task *TaskItem, exists bool) error {
+		if !exists {
+			return errTaskNotFound
+		}
+		return fn(task, index)
+	})
+}
+
+// getTask returns a single task, or nil when it does not exist.
+func (p *Plugin) getTask(listKey, taskID string) (*TaskItem, error) {
+	key := taskItemKey(listKey, taskID)
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	task := &TaskItem{}
+	if err := p.unmarshalValue(key, data, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// taskExists reports whether a task is stored. Errors count as existing, so callers err on the
+// side of keeping data.
+func (p *Plugin) taskExists(listKey, taskID string) bool {
+	data, appErr := p.API.KVGet(taskItemKey(listKey, taskID))
+	return appErr != nil || data != nil
+}
+
+// ungroupTasks clears the group of every task in the list that belongs to groupID.
+func (p *Plugin) ungroupTasks(listKey, groupID string) error {
+	index, err := p.loadTaskIndex(listKey)
+	if err != nil {
+		return err
+	}
+
+	for _, taskID := range index.TaskIDs {
+		if _, err := p.mutateTask(listKey, taskID, func(task *TaskItem, _ *taskListIndex) error {
+			if task.GroupID != groupID {
+				return errTaskUnchanged
+			}
+			task.GroupID = ""
+			task.Version++
+			task.UpdatedAt = time.Now()
+			return nil
+		}); err != nil && !errors.Is(err, errTaskNotFound) && !errors.Is(err, errTaskUnchanged) {
+			return err
+		}
+	}
+	return nil
+}
+
+// versionETag formats an entity version as a strong ETag.
+func versionETag(version int64) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// listETag derives an ETag for a whole task list from its content.
+func listETag(list *ChannelTaskList) string {
+	data, _ := json.Marshal(list)
+	return fmt.Sprintf("\"%x\"", sha1.Sum(data))
+}
+
+// expectedVersion returns the version a write is conditional on. The If-Match header takes
+// precedence; without it the version the client sent in the body is used, so a client that
+// echoes back a task it read earlier cannot overwrite a newer copy. conditional is false for
+// "If-Match: *" and for bodies without a version.
+func expectedVersion(r *http.Request, bodyVersion int64) (version int64, conditional bool, err error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		return bodyVersion, bodyVersion > 0, nil
+	}
+	if ifMatch == "*" {
+		return 0, false, nil
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(ifMatch, "W/"), "\"")
+	version, err = strconv.ParseInt(tag, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid If-Match header %q", ifMatch)
+	}
+	return version, true, nil
+}
+
+// checkVersion returns a staleError carrying current when a conditional write expects a
+// different version than the stored one.
+func checkVersion(conditional bool, expected, actual int64, current interface{}) error {
+	if conditional && expected != actual {
+		return &staleError{Current: current, Version: actual}
+	}
+	return nil
+}
+
+// writeStoreError maps an error returned by the task store to an HTTP response.
+func (p *Plugin) writeStoreError(w http.ResponseWriter, err error) {
+	var stale *staleError
+	var invalid *validationError
+	switch {
+	case errors.As(err, &invalid):
+		writeAPIError(w, http.StatusBadRequest, "invalid_task", invalid.Error())
+	case errors.As(err, &stale):
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", versionETag(stale.Version))
+		w.WriteHeader(http.StatusPreconditionFailed)
+		json.NewEncoder(w).Encode(stale.Current)
+	case errors.Is(err, errCorruptValue):
+		writeAPIError(w, http.StatusInternalServerError, "corrupt_task_data", "Stored task data could not be read. It has been preserved; please contact your system administrator.")
+	case errors.Is(err, errTaskListConflict):
+		writeAPIError(w, http.StatusConflict, "task_list_conflict", err.Error())
+	case errors.Is(err, errTaskNotFound):
+		http.Error(w, "Task not found", http.StatusNotFound)
+	case errors.Is(err, errGroupNotFound):
+		http.Error(w, "Group not found", http.StatusNotFound)
+	default:
+		p.API.LogError("Task store request failed", "error", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectedVersion(t *testing.T) {
+	tests := []struct {
+		name            string
+		ifMatch         string
+		bodyVersion     int64
+		wantVersion     int64
+		wantConditional bool
+		wantErr         bool
+	}{
+		{name: "no version", wantVersion: 0, wantConditional: false},
+		{name: "body version", bodyVersion: 4, wantVersion: 4, wantConditional: true},
+		{name: "If-Match wins over the body", ifMatch: `"7"`, bodyVersion: 4, wantVersion: 7, wantConditional: true},
+		{name: "weak tag", ifMatch: `W/"7"`, wantVersion: 7, wantConditional: true},
+		{name: "unquoted tag", ifMatch: " 7 ", wantVersion: 7, wantConditional: true},
+		{name: "wildcard", ifMatch: "*", bodyVersion: 4, wantVersion: 0, wantConditional: false},
+		{name: "not a version", ifMatch: `"abc"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/api/v1/tasks", nil)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+			version, conditional, err := expectedVersion(r, tt.bodyVersion)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantVersion, version)
+			assert.Equal(t, tt.wantConditional, conditional)
+		})
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	current := TaskItem{ID: "task", Version: 3}
+
+	tests := []struct {
+		name        string
+		conditional bool
+		expected    int64
+		wantStale   bool
+	}{
+		{name: "unconditional", conditional: false, expected: 1},
+		{name: "matching version", conditional: true, expected: 3},
+		{name: "stale version", conditional: true, expected: 2, wantStale: true},
+		{name: "newer version", conditional: true, expected: 4, wantStale: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkVersion(tt.conditional, tt.expected, current.Version, current)
+			if !tt.wantStale {
+				assert.NoError(t, err)
+				return
+			}
+			var stale *staleError
+			require.True(t, errors.As(err, &stale))
+			assert.Equal(t, int64(3), stale.Version)
+			assert.Equal(t, current, stale.Current)
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+const dailyPrefsPrefix = "daily_prefs_"
+
+// The sections of the daily summary, as stored in UserDailyPrefs.HiddenSections.
+const (
+	summaryCompletedYesterday = "completed_yesterday"
+	summaryOverdue            = "overdue"
+	summaryToday              = "today"
+	summaryHighPriority       = "high_priority"
+	summaryWeek               = "week"
+	summaryOther              = "other"
+)
+
+// The layouts of the daily summary. An empty layout is detailed.
+const (
+	summaryLayoutDetailed = "detailed"
+	summaryLayoutCompact  = "compact"
+)
+
+// summarySettingsPath receives the submission of the summary settings dialog.
+const summarySettingsPath = "/api/v1/dialog/summary-settings"
+
+// summarySections lists the sections in the order of the summary, with their names in the
+// settings dialog.
+var summarySections = []struct {
+	Name  string
+	Label string
+}{
+	{summaryCompletedYesterday, "Completed yesterday"},
+	{summaryOverdue, "Past due"},
+	{summaryToday, "Due today"},
+	{summaryHighPriority, "High priority (P0 and P1) not due yet"},
+	{summaryWeek, "Due within 1 week"},
+	{summaryOther, "Everything else"},
+}
+
+// errSummaryNotDue aborts claiming a daily summary that should not be sent now.
+var errSummaryNotDue = errors.New("daily summary not due")
+
+func dailyPrefsKey(userID string) string {
+	return dailyPrefsPrefix + userID
+}
+
+// parseSummaryTime accepts a time of day such as 08:30, 8:30, 17:00, 9am or 5:30pm and returns it
+// as "15:04".
+func parseSummaryTime(value string) (string, bool) {
+	value = strings.ToLower(strings.ReplaceAll(value, " ", ""))
+	for _, layout := range []string{"15:04", "3:04pm", "3pm"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("15:04"), true
+		}
+	}
+	return "", false
+}
+
+// summaryTimeReached reports whether now, in the user's time zone, is at or after the summary
+// time. An empty summary time is always reached.
+func summaryTimeReached(summaryTime string, now time.Time) bool {
+	if summaryTime == "" {
+		return true
+	}
+	t, err := time.Parse("15:04", summaryTime)
+	if err != nil {
+		return true
+	}
+	return now.Hour()*60+now.Minute() >= t.Hour()*60+t.Minute()
+}
+
+// summaryTime returns when the user's summary is sent: their own time, or else the default time
+// from the configuration. An empty result sends it on their first activity of the day.
+func (prefs *UserDailyPrefs) summaryTime(config *configuration) string {
+	if prefs.SummaryTime != "" {
+		return prefs.SummaryTime
+	}
+	return config.summaryTime()
+}
+
+// runDailySummaryJob sends the summaries of users who have a summary time, their own or the
+// default one, and have not had today's summary yet. Users without one get theirs on their first
+// activity of the day. See claimDailySummary for how users who never changed their preferences
+// become known to the job.
+func (p *Plugin) runDailySummaryJob() {
+	keys, err := p.listKeys(func(key string) bool {
+		return strings.HasPrefix(key, dailyPrefsPrefix)
+	})
+	if err != nil {
+		p.API.LogError("Failed to list daily summary preferences", "error", err.Error())
+		return
+	}
+
+	config := p.getConfiguration()
+	for _, key := range keys {
+		userID := strings.TrimPrefix(key, dailyPrefsPrefix)
+		prefs := p.getUserDailyPrefs(userID)
+		if !prefs.Enabled || prefs.summaryTime(config) == "" {
+			continue
+		}
+		now := p.userNow(userID)
+		if p.claimDailySummary(userID, now) {
+			p.sendDailyTaskSummary(userID, now)
+		}
+	}
+}
+
+// handleDailySummaryTime runs `/tasks message time <time>|off`.
+func (p *Plugin) handleDailySummaryTime(args *model.CommandArgs, words []string) *model.CommandResponse {
+	if len(words) == 0 {
+		return ephemeralResponse("❌ Usage: `/tasks message time 08:30` or `/tasks message time off`")
+	}
+
+	prefs := p.getUserDailyPrefs(args.UserId)
+	value := strings.Join(words, " ")
+	if strings.EqualFold(value, "off") || strings.EqualFold(value, "none") {
+		prefs.SummaryTime = ""
+	} else {
+		summaryTime, ok := parseSummaryTime(value)
+		if !ok {
+			return ephemeralResponse(fmt.Sprintf("❌ I don't understand the time `%s`. Try `08:30`, `17:00` or `9am`.", value))
+		}
+		prefs.SummaryTime = summaryTime
+		prefs.Enabled = true
+	}
+
+	if err := p.saveUserDailyPrefs(args.UserId, prefs); err != nil {
+		p.API.LogError("Failed to save daily summary preferences", "user_id", args.UserId, "error", err.Error())
+		return ephemeralResponse("❌ Error saving your preference. Please try again.")
+	}
+
+	summaryTime := prefs.summaryTime(p.getConfiguration())
+	if summaryTime == "" {
+		return ephemeralResponse("✅ Your daily task summary will be sent when you first become active each day.")
+	}
+	loc := p.userLocation(args.UserId)
+	return ephemeralResponse(fmt.Sprintf("⏰ Your daily task summary will be sent at **%s** (%s) each day. Change your time zone in **Settings > Display > Timezone**.", summaryTime, loc.String()))
+}
+
+func (prefs *UserDailyPrefs) hidesSection(name string) bool {
+	for _, hidden := range prefs.HiddenSections {
+		if hidden == name {
+			return true
+		}
+	}
+	return false
+}
+
+// includesTask reports whether a task belongs in the user's summary. Private tasks without a
+// deadline are left out unless the user asked for them or they are high priority, as they have
+// no urgency to report.
+func (prefs *UserDailyPrefs) includesTask(t TaskWithContext) bool {
+	if t.IsPrivate {
+		return t.Task.Completed || t.Task.Deadline != nil || isHighPriority(t.Task) || prefs.IncludeUndatedPrivate
+	}
+	for _, id := range prefs.ExcludedChannelIDs {
+		if id == t.ChannelID {
+			return false
+		}
+	}
+	return true
+}
+
+// skipsDay reports whether no summary is wanted on now's day.
+func (prefs *UserDailyPrefs) skipsDay(now time.Time) bool {
+	return prefs.WeekdaysOnly && (now.Weekday() == time.Saturday || now.Weekday() == time.Sunday)
+}
+
+// openSummarySettings shows the dialog for choosing what the daily summary contains.
+func (p *Plugin) openSummarySettings(args *model.CommandArgs) *model.CommandResponse {
+	prefs := p.getUserDailyPrefs(args.UserId)
+
+	var elements []model.DialogElement
+	for _, section := range summarySections {
+		elements = append(elements, model.DialogElement{
+			DisplayName: section.Label,
+			Name:        "section_" + section.Name,
+			Type:        "bool",
+			Placeholder: "Include this section",
+			Default:     strconv.FormatBool(!prefs.hidesSection(section.Name)),
+			Optional:    true,
+		})
+	}
+
+	layout := prefs.Layout
+	if layout == "" {
+		layout = summaryLayoutDetailed
+	}
+	elements = append(elements,
+		model.DialogElement{
+			DisplayName: "Private tasks without a deadline",
+			Name:        "include_undated_private",
+			Type:        "bool",
+			Placeholder: "Include them under Everything else",
+			Default:     strconv.FormatBool(prefs.IncludeUndatedPrivate),
+			Optional:    true,
+		},
+		model.DialogElement{
+			DisplayName: "Weekdays only",
+			Name:        "weekdays_only",
+			Type:        "bool",
+			Placeholder: "Skip the summary on Saturdays and Sundays",
+			Default:     strconv.FormatBool(prefs.WeekdaysOnly),
+			Optional:    true,
+		},
+		model.DialogElement{
+			DisplayName: "Layout",
+			Name:        "layout",
+			Type:        "radio",
+			Default:     layout,
+			Options: []*model.PostActionOptions{
+				{Text: "Detailed: numbers, groups, deadlines and thread links", Value: summaryLayoutDetailed},
+				{Text: "Compact: one short line per task", Value: summaryLayoutCompact},
+			},
+		},
+		model.DialogElement{
+			DisplayName: "Excluded channels",
+			Name:        "excluded_channels",
+			Type:        "text",
+			Default:     strings.Join(p.channelHandles(prefs.ExcludedChannelIDs), ", "),
+			Placeholder: "town-square, off-topic",
+			HelpText:    "Channels whose tasks are left out of the summary, separated by commas.",
+			Optional:    true,
+		},
+		model.DialogElement{
+			DisplayName: "Summary time",
+			Name:        "summary_time",
+			Type:        "text",
+			Default:     prefs.SummaryTime,
+			Placeholder: "08:30",
+			HelpText:    "Send the summary at this time in your time zone. Leave empty to use the default time, or to get it on your first activity of the day when there is none.",
+			Optional:    true,
+		},
+	)
+
+	request := model.OpenDialogRequest{
+		TriggerId: args.TriggerId,
+		URL:       "/plugins/" + pluginID + summarySettingsPath,
+		Dialog: model.Dialog{
+			CallbackId:  "summary_settings",
+			Title:       "Daily Task Summary",
+			Elements:    elements,
+			SubmitLabel: "Save",
+		},
+	}
+	if appErr := p.API.OpenInteractiveDialog(request); appErr != nil {
+		p.API.LogError("Failed to open summary settings", "user_id", args.UserId, "error", appErr.Error())
+		return ephemeralResponse("❌ Could not open the summary settings. Please try again.")
+	}
+	return &model.CommandResponse{}
+}
+
+// channelHandles returns the names of channels as used in ~mentions, skipping unknown ones.
+func (p *Plugin) channelHandles(channelIDs []string) []string {
+	names := make([]string, 0, len(channelIDs))
+	for _, id := range channelIDs {
+		if channel, appErr := p.API.GetChannel(id); appErr == nil {
+			names = append(names, channel.Name)
+		}
+	}
+	return names
+}
+
+// handleSummarySettings saves the submission of the summary settings dialog.
+func (p *Plugin) handleSummarySettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req model.SubmitDialogRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID := r.Header.Get("Mattermost-User-Id")
+	if req.Cancelled {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	prefs := p.getUserDailyPrefs(userID)
+	errs := make(map[string]string)
+
+	prefs.HiddenSections = nil
+	for _, section := range summarySections {
+		if !dialogBool(req.Submission, "section_"+section.Name) {
+			prefs.HiddenSections = append(prefs.HiddenSections, section.Name)
+		}
+	}
+	prefs.IncludeUndatedPrivate = dialogBool(req.Submission, "include_undated_private")
+	prefs.WeekdaysOnly = dialogBool(req.Submission, "weekdays_only")
+
+	prefs.Layout = ""
+	if layout, _ := req.Submission["layout"].(string); layout == summaryLayoutCompact {
+		prefs.Layout = summaryLayoutCompact
+	}
+
+	excluded, _ := req.Submission["excluded_channels"].(string)
+	channelIDs, err := p.resolveChannelHandles(userID, excluded)
+	if err != nil {
+		errs["excluded_channels"] = err.Error()
+	}
+	prefs.ExcludedChannelIDs = channelIDs
+
+	prefs.SummaryTime = ""
+	if value, _ := req.Submission["summary_time"].(string); strings.TrimSpace(value) != "" {
+		summaryTime, ok := parseSummaryTime(value)
+		if !ok {
+			errs["summary_time"] = "Use a time such as 08:30, 17:00 or 9am."
+		}
+		prefs.SummaryTime = summaryTime
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(errs) > 0 {
+		json.NewEncoder(w).Encode(model.SubmitDialogResponse{Errors: errs})
+		return
+	}
+	if len(prefs.HiddenSections) == len(summarySections) {
+		json.NewEncoder(w).Encode(model.SubmitDialogResponse{Error: "Keep at least one section, or use /tasks message off to stop the summary."})
+		return
+	}
+
+	if err := p.saveUserDailyPrefs(userID, prefs); err != nil {
+		p.API.LogError("Failed to save daily summary preferences", "user_id", userID, "error", err.Error())
+		json.NewEncoder(w).Encode(model.SubmitDialogResponse{Error: "Error saving your settings. Please try again."})
+		return
+	}
+
+	if req.ChannelId != "" {
+		p.API.SendEphemeralPost(userID, &model.Post{
+			ChannelId: req.ChannelId,
+			Message:   "✅ Your daily task summary settings have been saved.",
+		})
+	}
+	json.NewEncoder(w).Encode(model.SubmitDialogResponse{})
+}
+
+// dialogBool reads a bool element of a dialog submission. Unchecked elements may be missing.
+func dialogBool(submission map[string]interface{}, name string) bool {
+	switch value := submission[name].(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	}
+	return false
+}
+
+// resolveChannelHandles turns a comma separated list of channel names, with or without ~, into
+// the IDs of channels the user belongs to. Display names may contain spaces.
+func (p *Plugin) resolveChannelHandles(userID, value string) ([]string, error) {
+	var wanted []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "~")); name != "" {
+			wanted = append(wanted, name)
+		}
+	}
+	if len(wanted) == 0 {
+		return nil, nil
+	}
+
+	channels, appErr := p.API.GetChannelsForTeamForUser("", userID, false)
+	if appErr != nil {
+		return nil, appErr
+	}
+	byName := make(map[string]string, len(channels))
+	for _, channel := range channels {
+		byName[channel.Name] = channel.Id
+		byName[strings.ToLower(channel.DisplayName)] = channel.Id
+	}
+
+	var ids, unknown []string
+	for _, name := range wanted {
+		id, ok := byName[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("You are not in a channel called %s.", strings.Join(unknown, ", "))
+	}
+	return ids, nil
+}
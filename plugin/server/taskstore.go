@@ -0,0 +1,452 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// ScopeKind is the kind of owner a task list belongs to.
+type ScopeKind string
+
+const (
+	ScopeChannel ScopeKind = "channel"
+	ScopePrivate ScopeKind = "private"
+)
+
+// Scope identifies one task list: the list of a channel or the private list of a user.
+type Scope struct {
+	Kind ScopeKind
+	ID   string
+}
+
+func ChannelScope(channelID string) Scope {
+	return Scope{Kind: ScopeChannel, ID: channelID}
+}
+
+func PrivateScope(userID string) Scope {
+	return Scope{Kind: ScopePrivate, ID: userID}
+}
+
+// listKey is the KV key prefix of the list; see taskIndexKey and taskItemKey.
+func (s Scope) listKey() string {
+	switch s.Kind {
+	case ScopePrivate:
+		return "private_tasks_" + s.ID
+	default:
+		return "tasks_" + s.ID
+	}
+}
+
+// IsPrivate reports whether the list belongs to a single user.
+func (s Scope) IsPrivate() bool {
+	return s.Kind == ScopePrivate
+}
+
+// AllowsAssignees reports whether tasks in the list can be assigned to users.
+func (s Scope) AllowsAssignees() bool {
+	return s.Kind != ScopePrivate
+}
+
+// taskRef points to a task from one of the indexes kept outside its list, such as the tasks
+// linked to a thread.
+type taskRef struct {
+	ScopeKind ScopeKind `json:"scope_kind"`
+	ScopeID   string    `json:"scope_id"`
+	TaskID    string    `json:"task_id"`
+}
+
+func (ref taskRef) scope() Scope {
+	return Scope{Kind: ref.ScopeKind, ID: ref.ScopeID}
+}
+
+// TaskStore is the single entry point for reading and changing task lists. HTTP handlers, slash
+// commands and the daily summary all go through it, whatever the scope of the list.
+//
+// Update callbacks may be called more than once when a write has to be retried, so they must
+// only depend on the values they are given. Returning an error from a callback aborts the write.
+type TaskStore interface {
+	GetList(scope Scope) (*ChannelTaskList, error)
+	// CreateTask assigns the ID, number, timestamps and first version of the task and stores it.
+	// A new task has no thread activity yet.
+	CreateTask(scope Scope, task TaskItem) (*TaskItem, error)
+	// UpdateTask applies fn to the stored task and bumps its version.
+	UpdateTask(scope Scope, taskID string, fn func(task *TaskItem, groups []TaskGroup) error) (*TaskItem, error)
+	// DeleteTask moves a task to the trash of its list; check can veto the delete after seeing
+	// the stored copy.
+	DeleteTask(scope Scope, taskID string, check func(task TaskItem) error) error
+	// DeleteTasks moves several tasks to the trash with one write of the trash index and one of
+	// the list index. check can veto each delete; tasks that are vetoed, missing or changed
+	// while they were being deleted are returned in failed and stay in the list.
+	DeleteTasks(scope Scope, taskIDs []string, check func(task TaskItem) error) (deleted []TaskItem, failed map[string]error, err error)
+	// RecordActivity notes a reply in the task's thread. It does not change the version, so
+	// clients editing the task are not interrupted by a busy thread.
+	RecordActivity(scope Scope, taskID string, at time.Time) error
+
+	// CreateGroup assigns the ID and first version of the group and stores it.
+	CreateGroup(scope Scope, group TaskGroup) (*TaskGroup, error)
+	// UpdateGroup applies fn to the stored group and bumps its version.
+	UpdateGroup(scope Scope, groupID string, fn func(group *TaskGroup) error) (*TaskGroup, error)
+	// DeleteGroup moves a group to the trash of its list and moves its tasks out of it.
+	DeleteGroup(scope Scope, groupID string, check func(group TaskGroup) error) error
+
+	// GetTrash returns the deleted tasks and groups of a list that have not been purged yet.
+	GetTrash(scope Scope) (*listTrash, error)
+	// RestoreTask puts a deleted task back into its list and its group. When the group is gone
+	// it is restored from the trash or recreated, and returned.
+	RestoreTask(scope Scope, taskID string) (*TaskItem, *TaskGroup, error)
+	// RestoreGroup puts a deleted group back. Its tasks stay where they are.
+	RestoreGroup(scope Scope, groupID string) (*TaskGroup, error)
+}
+
+// errActivityUpToDate aborts an activity write that would not change anything worth storing.
+var errActivityUpToDate = errors.New("activity already recorded")
+
+// kvTaskStore keeps task lists in the plugin KV store with one key per task and an index per list.
+type kvTaskStore struct {
+	plugin *Plugin
+}
+
+func (s *kvTaskStore) GetList(scope Scope) (*ChannelTaskList, error) {
+	return s.plugin.loadTaskList(scope.listKey())
+}
+
+func (s *kvTaskStore) CreateTask(scope Scope, task TaskItem) (*TaskItem, error) {
+	number, err := s.plugin.allocateTaskNumber(scope.listKey())
+	if err != nil {
+		return nil, err
+	}
+
+	task.ID = model.NewId()
+	task.Number = number
+	task.CreatedAt = time.Now()
+	task.UpdatedAt = task.CreatedAt
+	task.CompletedAt = time.Time{}
+	if task.Completed {
+		task.CompletedAt = task.CreatedAt
+	}
+	task.Version = 1
+	task.LastActivityAt = nil
+
+	if err := s.plugin.insertTask(scope.listKey(), task); err != nil {
+		return nil, err
+	}
+	s.plugin.updateThreadLink(scope, task.ID, "", task.ThreadID)
+	s.plugin.updateDeadlineIndex(scope, task.ID, nil, &task)
+	return &task, nil
+}
+
+func (s *kvTaskStore) UpdateTask(scope Scope, taskID string, fn func(task *TaskItem, groups []TaskGroup) error) (*TaskItem, error) {
+	var before TaskItem
+	result, err := s.plugin.mutateTask(scope.listKey(), taskID, func(task *TaskItem, index *taskListIndex) error {
+		before = *task
+		version, number := task.Version, task.Number
+		if err := fn(task, index.Groups); err != nil {
+			return err
+		}
+		task.ID = taskID
+		task.Number = number
+		task.Version = version + 1
+		task.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.plugin.updateThreadLink(scope, taskID, before.ThreadID, result.ThreadID)
+	s.plugin.updateDeadlineIndex(scope, taskID, &before, result)
+	return result, nil
+}
+
+func (s *kvTaskStore) DeleteTask(scope Scope, taskID string, check func(task TaskItem) error) error {
+	// A single delete goes through DeleteTasks so the trash is written the same way, outside any
+	// compare-and-set loop. It is retried when the task changed between being checked and
+	// removed.
+	for attempt := 0; attempt < kvMaxRetries; attempt++ {
+		_, failed, err := s.DeleteTasks(scope, []string{taskID}, check)
+		if err != nil {
+			return err
+		}
+		if err := failed[taskID]; !errors.Is(err, errTaskListConflict) {
+			return err
+		}
+	}
+	return errTaskListConflict
+}
+
+func (s *kvTaskStore) DeleteTasks(scope Scope, taskIDs []string, check func(task TaskItem) error) ([]TaskItem, map[string]error, error) {
+	listKey := scope.listKey()
+	index, err := s.plugin.loadTaskIndex(listKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type storedTask struct {
+		task TaskItem
+		data []byte
+	}
+	failed := make(map[string]error)
+	var found []storedTask
+	var tasks []TaskItem
+	for _, taskID := range taskIDs {
+		key := taskItemKey(listKey, taskID)
+		data, appErr := s.plugin.API.KVGet(key)
+		if appErr != nil {
+			return nil, nil, appErr
+		}
+		if data == nil {
+			failed[taskID] = errTaskNotFound
+			continue
+		}
+		var task TaskItem
+		if err := s.plugin.unmarshalValue(key, data, &task); err != nil {
+			failed[taskID] = err
+			continue
+		}
+		if err := check(task); err != nil {
+			failed[taskID] = err
+			continue
+		}
+		found = append(found, storedTask{task: task, data: data})
+		tasks = append(tasks, task)
+	}
+	if len(found) == 0 {
+		return nil, failed, nil
+	}
+
+	// The tasks go into the trash before they are removed, so a failed write never loses them.
+	if err := s.plugin.trashTasks(listKey, tasks, index.Groups); err != nil {
+		return nil, nil, err
+	}
+
+	var deleted []TaskItem
+	removed := make(map[string]bool)
+	for _, f := range found {
+		ok, appErr := s.plugin.API.KVCompareAndDelete(taskItemKey(listKey, f.task.ID), f.data)
+		if appErr != nil || !ok {
+			// Changed since it was checked, so it is kept and taken out of the trash again.
+			s.plugin.untrash(listKey, f.task.ID)
+			failed[f.task.ID] = errTaskListConflict
+			if appErr != nil {
+				failed[f.task.ID] = appErr
+			}
+			continue
+		}
+		deleted = append(deleted, f.task)
+		removed[f.task.ID] = true
+	}
+	if len(deleted) == 0 {
+		return nil, failed, nil
+	}
+
+	// The tasks are gone at this point; an index that still lists them is tolerated by
+	// loadTaskList, so a failure here is only logged.
+	if _, err := s.plugin.mutateIndex(listKey, func(index *taskListIndex) error {
+		taskIDs := index.TaskIDs[:0]
+		for _, id := range index.TaskIDs {
+			if !removed[id] {
+				taskIDs = append(taskIDs, id)
+			}
+		}
+		index.TaskIDs = taskIDs
+		return nil
+	}); err != nil {
+		s.plugin.API.LogWarn("Failed to remove deleted tasks from the index", "list", listKey, "error", err.Error())
+	}
+
+	for _, task := range deleted {
+		s.plugin.updateThreadLink(scope, task.ID, task.ThreadID, "")
+		s.plugin.clearTaskReminders(task.ID)
+	}
+	s.plugin.removeFromDeadlineIndex(scope, deleted)
+	return deleted, failed, nil
+}
+
+func (s *kvTaskStore) RecordActivity(scope Scope, taskID string, at time.Time) error {
+	_, err := s.plugin.mutateTask(scope.listKey(), taskID, func(task *TaskItem, _ *taskListIndex) error {
+		if task.LastActivityAt != nil && at.Sub(*task.LastActivityAt) < threadActivityInterval {
+			return errActivityUpToDate
+		}
+		task.LastActivityAt = &at
+		return nil
+	})
+	if errors.Is(err, errActivityUpToDate) {
+		return nil
+	}
+	return err
+}
+
+func (s *kvTaskStore) CreateGroup(scope Scope, group TaskGroup) (*TaskGroup, error) {
+	group.ID = model.NewId()
+	group.Version = 1
+
+	if _, err := s.plugin.mutateIndex(scope.listKey(), func(index *taskListIndex) error {
+		index.Groups = append(index.Groups, group)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (s *kvTaskStore) UpdateGroup(scope Scope, groupID string, fn func(group *TaskGroup) error) (*TaskGroup, error) {
+	var result TaskGroup
+	if _, err := s.plugin.mutateIndex(scope.listKey(), func(index *taskListIndex) error {
+		for i := range index.Groups {
+			if index.Groups[i].ID != groupID {
+				continue
+			}
+			group := index.Groups[i]
+			if err := fn(&group); err != nil {
+				return err
+			}
+			group.ID = groupID
+			group.Version = index.Groups[i].Version + 1
+			index.Groups[i] = group
+			result = group
+			return nil
+		}
+		return errGroupNotFound
+	}); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *kvTaskStore) DeleteGroup(scope Scope, groupID string, check func(group TaskGroup) error) error {
+	listKey := scope.listKey()
+	// The group goes into the trash before it is removed from the index, and outside the
+	// compare-and-set loop of that write. The removal only goes ahead if the group is still the
+	// one that was trashed; otherwise the trash entry is taken back and the delete starts over.
+	for attempt := 0; attempt < kvMaxRetries; attempt++ {
+		index, err := s.plugin.loadTaskIndex(listKey)
+		if err != nil {
+			return err
+		}
+		var group *TaskGroup
+		for i := range index.Groups {
+			if index.Groups[i].ID == groupID {
+				group = &index.Groups[i]
+			}
+		}
+		if group == nil {
+			return errGroupNotFound
+		}
+		if err := check(*group); err != nil {
+			return err
+		}
+		if err := s.plugin.trashGroup(listKey, *group); err != nil {
+			return err
+		}
+
+		_, err = s.plugin.mutateIndex(listKey, func(index *taskListIndex) error {
+			for i, stored := range index.Groups {
+				if stored.ID == groupID {
+					if stored.Version != group.Version {
+						return errTaskListConflict
+					}
+					index.Groups = append(index.Groups[:i], index.Groups[i+1:]...)
+					return nil
+				}
+			}
+			return errGroupNotFound
+		})
+		if err == nil {
+			return s.plugin.ungroupTasks(listKey, groupID)
+		}
+		s.plugin.untrash(listKey, groupID)
+		if !errors.Is(err, errTaskListConflict) {
+			return err
+		}
+	}
+	return errTaskListConflict
+}
+
+func (s *kvTaskStore) GetTrash(scope Scope) (*listTrash, error) {
+	return s.plugin.getTrash(scope.listKey())
+}
+
+func (s *kvTaskStore) RestoreTask(scope Scope, taskID string) (*TaskItem, *TaskGroup, error) {
+	listKey := scope.listKey()
+	entry, err := s.plugin.getTrashedTask(listKey, taskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if entry == nil {
+		return nil, nil, errNotInTrash
+	}
+
+	task := entry.Task
+	var restored *TaskGroup
+	groupFromTrash := false
+	if task.GroupID != "" {
+		group, fromTrash, err := s.plugin.restoredGroup(listKey, *entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		group.Version++
+		if _, err := s.plugin.mutateIndex(listKey, func(index *taskListIndex) error {
+			restored = nil
+			for _, g := range index.Groups {
+				if g.ID == task.GroupID {
+					return nil
+				}
+			}
+			index.Groups = append(index.Groups, group)
+			restored = &group
+			return nil
+		}); err != nil {
+			return nil, nil, err
+		}
+		groupFromTrash = fromTrash && restored != nil
+	}
+
+	// The task keeps its ID and number. Its version moves on, so clients that still hold the
+	// deleted copy replace it.
+	task.Version++
+	task.UpdatedAt = time.Now()
+	if err := s.plugin.insertTask(listKey, task); err != nil {
+		return nil, nil, err
+	}
+	s.plugin.updateThreadLink(scope, task.ID, "", task.ThreadID)
+	s.plugin.updateDeadlineIndex(scope, task.ID, nil, &task)
+
+	if groupFromTrash {
+		s.plugin.untrash(listKey, task.ID, task.GroupID)
+	} else {
+		s.plugin.untrash(listKey, task.ID)
+	}
+	return &task, restored, nil
+}
+
+func (s *kvTaskStore) RestoreGroup(scope Scope, groupID string) (*TaskGroup, error) {
+	listKey := scope.listKey()
+	entry, err := s.plugin.getTrashedGroup(listKey, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, errNotInTrash
+	}
+
+	var group TaskGroup
+	if _, err := s.plugin.mutateIndex(listKey, func(index *taskListIndex) error {
+		group = entry.Group
+		group.Version++
+		for _, g := range index.Groups {
+			if g.ID == groupID {
+				// Already back, for example with a task restored from the trash.
+				group = g
+				return nil
+			}
+		}
+		index.Groups = append(index.Groups, group)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	s.plugin.untrash(listKey, groupID)
+	return &group, nil
+}
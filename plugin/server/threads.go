@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// threadActivityInterval limits how often a reply in a busy thread is written to its tasks.
+const threadActivityInterval = time.Minute
+
+// threadTasksKey holds the tasks linked to a thread, so a reply can be matched to its tasks
+// without loading every list of the channel.
+func threadTasksKey(rootID string) string {
+	return "thread_tasks_" + rootID
+}
+
+// linkThread records that a task is linked to the thread with the given root post.
+func (p *Plugin) linkThread(rootID string, scope Scope, taskID string) error {
+	_, err := casUpdate(p, threadTasksKey(rootID), func(refs *[]taskRef, _ bool) error {
+		for _, ref := range *refs {
+			if ref.TaskID == taskID {
+				return nil
+			}
+		}
+		*refs = append(*refs, taskRef{ScopeKind: scope.Kind, ScopeID: scope.ID, TaskID: taskID})
+		return nil
+	})
+	return err
+}
+
+// unlinkThread removes a task from the tasks linked to a thread.
+func (p *Plugin) unlinkThread(rootID, taskID string) error {
+	_, err := casUpdate(p, threadTasksKey(rootID), func(refs *[]taskRef, _ bool) error {
+		kept := []taskRef{}
+		for _, ref := range *refs {
+			if ref.TaskID != taskID {
+				kept = append(kept, ref)
+			}
+		}
+		*refs = kept
+		return nil
+	})
+	return err
+}
+
+// updateThreadLink keeps the thread index in step when a task's thread changes.
+func (p *Plugin) updateThreadLink(scope Scope, taskID, oldRootID, newRootID string) {
+	if oldRootID == newRootID {
+		return
+	}
+	if oldRootID != "" {
+		if err := p.unlinkThread(oldRootID, taskID); err != nil {
+			p.API.LogWarn("Failed to unlink task from thread", "task_id", taskID, "root_id", oldRootID, "error", err.Error())
+		}
+	}
+	if newRootID != "" {
+		if err := p.linkThread(newRootID, scope, taskID); err != nil {
+			p.API.LogWarn("Failed to link task to thread", "task_id", taskID, "root_id", newRootID, "error", err.Error())
+		}
+	}
+}
+
+// validateThread checks that a task of the scope may be linked to the thread with the given root
+// post. Channel tasks can only link threads of their channel; private tasks can link any thread
+// their owner can read.
+func (p *Plugin) validateThread(scope Scope, rootID string) error {
+	if rootID == "" {
+		return nil
+	}
+	if !model.IsValidId(rootID) {
+		return &validationError{Field: "thread_id", Message: "must be a post ID or null"}
+	}
+
+	post, appErr := p.API.GetPost(rootID)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return &validationError{Field: "thread_id", Message: "must be an existing post"}
+		}
+		return appErr
+	}
+	if post.RootId != "" {
+		return &validationError{Field: "thread_id", Message: "must be the root post of a thread"}
+	}
+	if scope.IsPrivate() {
+		if !p.API.HasPermissionToChannel(scope.ID, post.ChannelId, model.PermissionReadChannel) {
+			return &validationError{Field: "thread_id", Message: "must be a thread you can read"}
+		}
+	} else if post.ChannelId != scope.ID {
+		return &validationError{Field: "thread_id", Message: "must be a thread in this channel"}
+	}
+	return nil
+}
+
+// recordThreadActivity marks the tasks linked to a post's thread as active when someone replies.
+func (p *Plugin) recordThreadActivity(post *model.Post) {
+	if post.RootId == "" {
+		return
+	}
+
+	data, appErr := p.API.KVGet(threadTasksKey(post.RootId))
+	if appErr != nil || data == nil {
+		return
+	}
+	var refs []taskRef
+	if err := p.unmarshalValue(threadTasksKey(post.RootId), data, &refs); err != nil {
+		return
+	}
+
+	at := time.UnixMilli(post.CreateAt)
+	for _, ref := range refs {
+		err := p.store.RecordActivity(ref.scope(), ref.TaskID, at)
+		if errors.Is(err, errTaskNotFound) {
+			p.unlinkThread(post.RootId, ref.TaskID)
+		} else if err != nil {
+			p.API.LogWarn("Failed to record thread activity", "task_id", ref.TaskID, "root_id", post.RootId, "error", err.Error())
+		}
+	}
+}
+
+// taskLink returns a link to the conversation of a task: the post it was created from, or the
+// root of its thread. userID is used to pick a team for posts in DMs and GMs.
+func (p *Plugin) taskLink(task TaskItem, userID string) string {
+	if task.Permalink != "" {
+		return task.Permalink
+	}
+	if task.ThreadID == "" {
+		return ""
+	}
+
+	post, appErr := p.API.GetPost(task.ThreadID)
+	if appErr != nil {
+		return ""
+	}
+	channel, appErr := p.API.GetChannel(post.ChannelId)
+	if appErr != nil {
+		return ""
+	}
+	return p.postPermalink(post, channel, userID, "")
+}
+
+// formatTaskLink renders the link to a task's conversation and its last reply, dated in loc, for
+// command output and the daily summary, or "" for tasks without one.
+func (p *Plugin) formatTaskLink(task TaskItem, userID string, loc *time.Location) string {
+	link := p.taskLink(task, userID)
+	if link == "" {
+		return ""
+	}
+
+	result := fmt.Sprintf(" | [💬 thread](%s)", link)
+	if task.LastActivityAt != nil {
+		result += fmt.Sprintf(" _last reply %s_", task.LastActivityAt.In(loc).Format("Mon Jan 2"))
+	}
+	return result
+}
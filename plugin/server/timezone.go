@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+)
+
+// userLocation returns the time zone a user chose in Mattermost, or the server's time zone when
+// it is unset or unknown.
+func (p *Plugin) userLocation(userID string) *time.Location {
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return time.Local
+	}
+	name := user.GetPreferredTimezone()
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// userNow returns the current time in a user's time zone. Everything that depends on which day
+// it is for the user, such as "due today" or "completed yesterday", starts from it.
+func (p *Plugin) userNow(userID string) time.Time {
+	return time.Now().In(p.userLocation(userID))
+}
+
+// startOfDay returns midnight of t's day in t's time zone. Day boundaries such as "due today"
+// or "overdue" are all worked out from the user's now with it, together with localDeadline, so
+// days start at midnight in the user's time zone.
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// isDateOnly reports whether a deadline was picked as a date, which is stored as midnight UTC.
+func isDateOnly(deadline time.Time) bool {
+	deadline = deadline.UTC()
+	return deadline.Hour() == 0 && deadline.Minute() == 0 && deadline.Second() == 0 && deadline.Nanosecond() == 0
+}
+
+// localDeadline returns a deadline in loc. A deadline picked as a date means that calendar day
+// wherever the user is, so it becomes midnight of that day in loc.
+func localDeadline(deadline time.Time, loc *time.Location) time.Time {
+	if isDateOnly(deadline) {
+		deadline = deadline.UTC()
+		return time.Date(deadline.Year(), deadline.Month(), deadline.Day(), 0, 0, 0, 0, loc)
+	}
+	return deadline.In(loc)
+}
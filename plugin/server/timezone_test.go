@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartOfDay(t *testing.T) {
+	east := time.FixedZone("UTC+9", 9*60*60)
+	west := time.FixedZone("UTC-7", -7*60*60)
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{name: "UTC", t: time.Date(2026, 10, 14, 15, 4, 5, 6, time.UTC), want: time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC)},
+		{name: "midnight", t: time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC), want: time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC)},
+		{name: "east of UTC", t: time.Date(2026, 10, 15, 1, 0, 0, 0, east), want: time.Date(2026, 10, 15, 0, 0, 0, 0, east)},
+		{name: "west of UTC", t: time.Date(2026, 10, 14, 23, 0, 0, 0, west), want: time.Date(2026, 10, 14, 0, 0, 0, 0, west)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := startOfDay(tt.t)
+			assert.True(t, tt.want.Equal(got), "got %s, want %s", got, tt.want)
+			assert.Equal(t, tt.t.Location(), got.Location())
+		})
+	}
+}
+
+func TestLocalDeadline(t *testing.T) {
+	east := time.FixedZone("UTC+9", 9*60*60)
+	west := time.FixedZone("UTC-7", -7*60*60)
+
+	tests := []struct {
+		name     string
+		deadline time.Time
+		loc      *time.Location
+		want     time.Time
+	}{
+		{
+			name:     "date keeps its calendar day east of UTC",
+			deadline: time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC),
+			loc:      east,
+			want:     time.Date(2026, 10, 14, 0, 0, 0, 0, east),
+		},
+		{
+			name:     "date keeps its calendar day west of UTC",
+			deadline: time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC),
+			loc:      west,
+			want:     time.Date(2026, 10, 14, 0, 0, 0, 0, west),
+		},
+		{
+			name:     "date stored in another zone",
+			deadline: time.Date(2026, 10, 14, 9, 0, 0, 0, east),
+			loc:      west,
+			want:     time.Date(2026, 10, 14, 0, 0, 0, 0, west),
+		},
+		{
+			name:     "time is the same instant",
+			deadline: time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC),
+			loc:      west,
+			want:     time.Date(2026, 10, 14, 8, 30, 0, 0, west),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := localDeadline(tt.deadline, tt.loc)
+			assert.True(t, tt.want.Equal(got), "got %s, want %s", got, tt.want)
+			assert.Equal(t, tt.loc, got.Location())
+		})
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	trashPrefix = "trash_"
+
+	defaultTrashRetentionDays = 30
+)
+
+// The kinds of entry in the trash.
+const (
+	trashKindTask  = "task"
+	trashKindGroup = "group"
+)
+
+var errNotInTrash = errors.New("not in the trash")
+
+// trashedTask is a deleted task. Group is the group it was in when it was deleted, so the group
+// can be recreated if it is gone by the time the task is restored.
+type trashedTask struct {
+	Task      TaskItem   `json:"task"`
+	Group     *TaskGroup `json:"group,omitempty"`
+	DeletedAt time.Time  `json:"deleted_at"`
+}
+
+type trashedGroup struct {
+	Group     TaskGroup `json:"group"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// listTrash holds the deleted tasks and groups of one list until they are restored or purged.
+// It is assembled from the trash index and the entries it points to.
+type listTrash struct {
+	Tasks  []trashedTask  `json:"tasks"`
+	Groups []trashedGroup `json:"groups"`
+}
+
+// trashRef is one entry of the trash index of a list. Each entry lives under its own key, so the
+// index stays small however much is deleted.
+type trashRef struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// The trash of a list is stored next to it under keys derived from its list key, e.g.
+// trash_tasks_{channelId}_index.
+func trashIndexKey(listKey string) string {
+	return trashPrefix + listKey + "_index"
+}
+
+func trashEntryKey(listKey, kind, id string) string {
+	return trashPrefix + listKey + "_" + kind + "_" + id
+}
+
+// isTaskIndexKey reports whether key holds the index of a task list.
+func isTaskIndexKey(key string) bool {
+	if !strings.HasSuffix(key, "_index") {
+		return false
+	}
+	for _, prefix := range []string{"tasks_", "private_tasks_"} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTrashIndexKey reports whether key holds the trash index of a list.
+func isTrashIndexKey(key string) bool {
+	return strings.HasPrefix(key, trashPrefix) && isTaskIndexKey(strings.TrimPrefix(key, trashPrefix))
+}
+
+// getTrashEntry loads one entry of the trash into value and reports whether it exists.
+func (p *Plugin) getTrashEntry(listKey, kind, id string, value interface{}) (bool, error) {
+	key := trashEntryKey(listKey, kind, id)
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return false, appErr
+	}
+	if data == nil {
+		return false, nil
+	}
+	if err := p.unmarshalValue(key, data, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (p *Plugin) getTrashedTask(listKey, taskID string) (*trashedTask, error) {
+	entry := &trashedTask{}
+	if ok, err := p.getTrashEntry(listKey, trashKindTask, taskID, entry); err != nil || !ok {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (p *Plugin) getTrashedGroup(listKey, groupID string) (*trashedGroup, error) {
+	entry := &trashedGroup{}
+	if ok, err := p.getTrashEntry(listKey, trashKindGroup, groupID, entry); err != nil || !ok {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// getTrash assembles the trash of a list in the order things were deleted. Index entries whose
+// entry is gone (a restore or purge that was interrupted half way) are skipped.
+func (p *Plugin) getTrash(listKey string) (*listTrash, error) {
+	var refs []trashRef
+	data, appErr := p.API.KVGet(trashIndexKey(listKey))
+	if appErr != nil {
+		return nil, appErr
+	}
+	if data != nil {
+		if err := p.unmarshalValue(trashIndexKey(listKey), data, &refs); err != nil {
+			return nil, err
+		}
+	}
+
+	trash := &listTrash{Tasks: []trashedTask{}, Groups: []trashedGroup{}}
+	for _, ref := range refs {
+		switch ref.Kind {
+		case trashKindTask:
+			entry, err := p.getTrashedTask(listKey, ref.ID)
+			if err != nil {
+				return nil, err
+			}
+			if entry != nil {
+				trash.Tasks = append(trash.Tasks, *entry)
+			}
+		case trashKindGroup:
+			entry, err := p.getTrashedGroup(listKey, ref.ID)
+			if err != nil {
+				return nil, err
+			}
+			if entry != nil {
+				trash.Groups = append(trash.Groups, *entry)
+			}
+		}
+	}
+	return trash, nil
+}
+
+// updateTrashIndex applies fn to the trash index of a list with compare-and-set.
+func (p *Plugin) updateTrashIndex(listKey string, fn func(refs []trashRef) []trashRef) error {
+	_, err := casUpdate(p, trashIndexKey(listKey), func(refs *[]trashRef, _ bool) error {
+		*refs = fn(*refs)
+		return nil
+	})
+	return err
+}
+
+// withoutTrashRefs returns refs without the entries with the given IDs.
+func withoutTrashRefs(refs []trashRef, ids map[string]bool) []trashRef {
+	kept := []trashRef{}
+	for _, ref := range refs {
+		if !ids[ref.ID] {
+			kept = append(kept, ref)
+		}
+	}
+	return kept
+}
+
+// putInTrash writes entries to the trash and then adds them to the index. Putting the same
+// entry in twice keeps one, so it can be called again when a delete is retried.
+func (p *Plugin) putInTrash(listKey string, kind string, entries map[string]interface{}, deletedAt time.Time) error {
+	ids := make(map[string]bool, len(entries))
+	for id, entry := range entries {
+		data, err := marshalValue(entry)
+		if err != nil {
+			return err
+		}
+		if appErr := p.API.KVSet(trashEntryKey(listKey, kind, id), data); appErr != nil {
+			return appErr
+		}
+		ids[id] = true
+	}
+
+	if err := p.updateTrashIndex(listKey, func(refs []trashRef) []trashRef {
+		refs = withoutTrashRefs(refs, ids)
+		for id := range ids {
+			refs = append(refs, trashRef{ID: id, Kind: kind, DeletedAt: deletedAt})
+		}
+		return refs
+	}); err != nil {
+		for id := range ids {
+			p.API.KVDelete(trashEntryKey(listKey, kind, id))
+		}
+		return err
+	}
+	return nil
+}
+
+// trashTasks puts tasks that are about to be deleted in the trash, with a single write of the
+// index. Each entry keeps the task's group so it can be restored with it.
+func (p *Plugin) trashTasks(listKey string, tasks []TaskItem, groups []TaskGroup) error {
+	now := time.Now()
+	entries := make(map[string]interface{}, len(tasks))
+	for _, task := range tasks {
+		entry := trashedTask{Task: task, DeletedAt: now}
+		for i := range groups {
+			if groups[i].ID == task.GroupID {
+				group := groups[i]
+				entry.Group = &group
+			}
+		}
+		entries[task.ID] = entry
+	}
+	return p.putInTrash(listKey, trashKindTask, entries, now)
+}
+
+// trashGroup puts a group that is about to be deleted in the trash, like trashTasks.
+func (p *Plugin) trashGroup(listKey string, group TaskGroup) error {
+	now := time.Now()
+	return p.putInTrash(listKey, trashKindGroup, map[string]interface{}{group.ID: trashedGroup{Group: group, DeletedAt: now}}, now)
+}
+
+// untrash takes entries out of the trash once they are restored, or when the delete they were
+// made for did not happen. The index is written first, so a failure part way leaves an entry
+// nobody can see rather than one that cannot be loaded.
+func (p *Plugin) untrash(listKey string, ids ...string) {
+	remove := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+	if err := p.updateTrashIndex(listKey, func(refs []trashRef) []trashRef {
+		return withoutTrashRefs(refs, remove)
+	}); err != nil {
+		p.API.LogWarn("Failed to take entries out of the trash", "list", listKey, "ids", strings.Join(ids, ","), "error", err.Error())
+		return
+	}
+	for _, id := range ids {
+		p.deleteTrashEntry(listKey, id)
+	}
+}
+
+// deleteTrashEntry deletes the stored entry of a task or group. IDs are unique across tasks and
+// groups, so both kinds of key can be tried.
+func (p *Plugin) deleteTrashEntry(listKey, id string) {
+	for _, kind := range []string{trashKindTask, trashKindGroup} {
+		if appErr := p.API.KVDelete(trashEntryKey(listKey, kind, id)); appErr != nil {
+			p.API.LogWarn("Failed to delete trash entry", "list", listKey, "id", id, "error", appErr.Error())
+		}
+	}
+}
+
+// runTrashPurgeJob deletes the tasks and groups that have been in the trash for longer than the
+// retention period, one entry at a time. It runs once a day on one node, see startScheduler.
+func (p *Plugin) runTrashPurgeJob(now time.Time) {
+	retention := p.getConfiguration().trashRetention()
+	if retention == 0 {
+		return
+	}
+	cutoff := now.Add(-retention)
+
+	keys, err := p.listKeys(isTrashIndexKey)
+	if err != nil {
+		p.API.LogError("Failed to list trash", "error", err.Error())
+		return
+	}
+
+	for _, key := range keys {
+		listKey := strings.TrimSuffix(strings.TrimPrefix(key, trashPrefix), "_index")
+		var expired []string
+		err := p.updateTrashIndex(listKey, func(refs []trashRef) []trashRef {
+			expired = nil
+			kept := []trashRef{}
+			for _, ref := range refs {
+				if ref.DeletedAt.Before(cutoff) {
+					expired = append(expired, ref.ID)
+					continue
+				}
+				kept = append(kept, ref)
+			}
+			return kept
+		})
+		if err != nil {
+			p.API.LogWarn("Failed to purge trash", "list", listKey, "error", err.Error())
+			continue
+		}
+		for _, id := range expired {
+			p.deleteTrashEntry(listKey, id)
+		}
+		if len(expired) > 0 {
+			p.API.LogDebug("Purged trash", "list", listKey, "count", len(expired))
+		}
+	}
+}
+
+// handleTrash serves the trash of a channel list.
+func (p *Plugin) handleTrash(w http.ResponseWriter, r *http.Request) {
+	channelID := r.URL.Query().Get("channel_id")
+	if channelID == "" {
+		http.Error(w, "channel_id required", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := p.authorizeChannel(w, r, channelID); !ok {
+		return
+	}
+
+	p.serveTrash(w, r, ChannelScope(channelID))
+}
+
+// handlePrivateTrash serves the trash of a private list.
+func (p *Plugin) handlePrivateTrash(w http.ResponseWriter, r *http.Request) {
+	userID, ok := p.resolvePrivateUser(w, r)
+	if !ok {
+		return
+	}
+
+	p.serveTrash(w, r, PrivateScope(userID))
+}
+
+// serveTrash lists the trash on GET and restores a task or group from it on POST to the restore
+// path.
+func (p *Plugin) serveTrash(w http.ResponseWriter, r *http.Request, scope Scope) {
+	if strings.HasSuffix(r.URL.Path, "/restore") {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p.restoreFromTrash(w, r, scope)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	trash, err := p.store.GetTrash(scope)
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
+	}
+
+	// Each entry says when it will be purged, so clients can warn about it.
+	type entry struct {
+		Task      *TaskItem  `json:"task,omitempty"`
+		Group     *TaskGroup `json:"group,omitempty"`
+		DeletedAt time.Time  `json:"deleted_at"`
+		PurgeAt   *time.Time `json:"purge_at,omitempty"`
+	}
+	retention := p.getConfiguration().trashRetention()
+	purgeAt := func(deletedAt time.Time) *time.Time {
+		if retention == 0 {
+			return nil
+		}
+		at := deletedAt.Add(retention)
+		return &at
+	}
+	response := struct {
+		Tasks  []entry `json:"tasks"`
+		Groups []entry `json:"groups"`
+	}{Tasks: []entry{}, Groups: []entry{}}
+	for i := range trash.Tasks {
+		t := trash.Tasks[i]
+		response.Tasks = append(response.Tasks, entry{Task: &t.Task, Group: t.Group, DeletedAt: t.DeletedAt, PurgeAt: purgeAt(t.DeletedAt)})
+	}
+	for i := range trash.Groups {
+		g := trash.Groups[i]
+		response.Groups = append(response.Groups, entry{Group: &g.Group, DeletedAt: g.DeletedAt, PurgeAt: purgeAt(g.DeletedAt)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// restoreFromTrash puts the task or group with the given ID back into the list. A task returns to
+// its group, which is restored or recreated first when it no longer exists.
+func (p *Plugin) restoreFromTrash(w http.ResponseWriter, r *http.Request, scope Scope) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+	userID := r.Header.Get("Mattermost-User-Id")
+
+	task, group, err := p.store.RestoreTask(scope, id)
+	if errors.Is(err, errNotInTrash) {
+		group, err = p.store.RestoreGroup(scope, id)
+	}
+	if errors.Is(err, errNotInTrash) {
+		writeAPIError(w, http.StatusNotFound, "not_in_trash", "There is no task or group with this id in the trash")
+		return
+	}
+	if err != nil {
+		p.writeStoreError(w, err)
+		return
+	}
+
+	if group != nil {
+		p.publishGroupEvent(scope, eventGroupCreated, group)
+	}
+	if task != nil {
+		p.publishTaskEvent(scope, eventTaskCreated, task)
+		p.appendTaskHistory(userID, scope, historyRestored, nil, task)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Task  *TaskItem  `json:"task,omitempty"`
+		Group *TaskGroup `json:"group,omitempty"`
+	}{task, group})
+}
+
+// restoredGroup returns the group a restored task belongs in when it is missing from the list:
+// the group from the trash if it is there, else the copy kept with the task.
+func (p *Plugin) restoredGroup(listKey string, entry trashedTask) (TaskGroup, bool, error) {
+	trashed, err := p.getTrashedGroup(listKey, entry.Task.GroupID)
+	if err != nil {
+		return TaskGroup{}, false, err
+	}
+	if trashed != nil {
+		return trashed.Group, true, nil
+	}
+	if entry.Group != nil {
+		return *entry.Group, false, nil
+	}
+	return TaskGroup{ID: entry.Task.GroupID, Name: "Restored"}, false, nil
+}
@@ -318,6 +318,16 @@ export const TaskItemComponent: React.FC<TaskItemComponentProps> = ({
                                    style={{width: '100%', padding: '4px', fontSize: '14px', border: `2px solid ${buttonBg}`, borderRadius: '3px', backgroundColor: centerChannelBg, color: centerChannelColor, outline: 'none'}}/>
                         ) : (
                             <div style={{display: 'inline-block'}}>
+                                {task.number ? (
+                                    <span style={{color: completedText, fontSize: '12px', marginLeft: '8px'}} title='Use this number with /tasks done, assign and due'>
+                                        #{task.number}
+                                    </span>
+                                ) : null}
+                                {task.priority ? (
+                                    <span style={{color: completedText, fontSize: '12px', fontWeight: 600, marginLeft: '6px'}} title='Priority, set with /tasks priority'>
+                                        {task.priority}
+                                    </span>
+                                ) : null}
                                 <span onClick={(e) => { e.stopPropagation(); handleTextClick(); }}
                                       style={{textDecoration: task.completed ? 'line-through' : 'none', color: task.completed ? completedText : centerChannelColor,
                                           wordBreak: 'break-word', fontSize: '14px', lineHeight: '1.5', cursor: task.completed ? 'default' : 'text',
@@ -361,6 +371,15 @@ export const TaskItemComponent: React.FC<TaskItemComponentProps> = ({
                         </div>
                     )}
 
+                    {task.permalink && !isEditing && (
+                        <a href={task.permalink} onClick={(e) => e.stopPropagation()} title="Go to the message this task was created from" style={{
+                            fontSize: '12px', color: adjustOpacity(centerChannelColor, centerChannelBg, 0.6),
+                            marginTop: '2px', padding: '2px 4px', borderRadius: '3px', display: 'inline-block'
+                        }}>
+                            <i className="icon icon-link-variant"></i>
+                        </a>
+                    )}
+
                     {!hideAssignees && (
                         <div style={{position: 'relative', marginRight: isHovered || showMenu || showAssigneePopup ? "20px" : "0px", transition: "margin-right 0.3s ease"}} ref={popupRef}>
                             {hasAssignees && (
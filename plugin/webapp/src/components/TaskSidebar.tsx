@@ -11,6 +11,7 @@ interface TaskSidebarProps {
     channel?: any;
     theme?: any;
     onChannelChange?: (callback: () => void) => void;
+    onListEvent?: (callback: (event: string, data: any) => void) => () => void;
     privateTasks?: boolean;
 }
 
@@ -71,6 +72,8 @@ const ConfettiAnimation: React.FC<{ theme: any }> = ({theme}) => {
 };
 
 export class TaskSidebar extends React.Component<TaskSidebarProps> {
+    private unsubscribeListEvents: (() => void) | null = null;
+
     state = {
         tasks: [] as TaskItem[],
         groups: [] as TaskGroup[],
@@ -117,9 +120,16 @@ export class TaskSidebar extends React.Component<TaskSidebarProps> {
                 }
             });
         }
+        if (this.props.onListEvent) {
+            this.unsubscribeListEvents = this.props.onListEvent(this.handleListEvent);
+        }
         this.setState({privateTasks: this.props.privateTasks});
     }
 
+    componentWillUnmount() {
+        if (this.unsubscribeListEvents) this.unsubscribeListEvents();
+    }
+
     componentDidUpdate(prevProps: any, prevState: any) {
         if (prevProps.privateTasks !== this.props.privateTasks) {
             this.setState({taskToShowNotes: null});
@@ -146,6 +156,42 @@ export class TaskSidebar extends React.Component<TaskSidebarProps> {
         }
     }
 
+    // Patches the list with a change someone made, if it belongs to the list being shown. Copies
+    // older than the one already shown are ignored, as events can arrive after a reload.
+    handleListEvent = (event: string, data: any) => {
+        const isShown = this.state.privateTasks ? data.scope === 'private' : data.channel_id === this.getChannelId();
+        if (!isShown) return;
+
+        if (data.task) {
+            const task: TaskItem = JSON.parse(data.task);
+            this.setState((state: any) => {
+                const current = state.tasks.find((t: TaskItem) => t.id === task.id);
+                const others = state.tasks.filter((t: TaskItem) => t.id !== task.id);
+                if (event === 'task_deleted') {
+                    return {tasks: others};
+                }
+                if (current && (current.version || 0) > (task.version || 0)) {
+                    return null;
+                }
+                return {tasks: [...others, task], hasEverHadTasks: true};
+            });
+        } else if (data.group) {
+            const group: TaskGroup = JSON.parse(data.group);
+            this.setState((state: any) => {
+                const current = state.groups.find((g: TaskGroup) => g.id === group.id);
+                const others = state.groups.filter((g: TaskGroup) => g.id !== group.id);
+                if (event === 'group_deleted') {
+                    const tasks = state.tasks.map((t: TaskItem) => t.group_id === group.id ? {...t, group_id: undefined} : t);
+                    return {groups: others, tasks};
+                }
+                if (current && (current.version || 0) > (group.version || 0)) {
+                    return null;
+                }
+                return {groups: [...others, group]};
+            });
+        }
+    };
+
     triggerConfetti = () => {
         this.setState({showConfetti: true});
         setTimeout(() => this.setState({showConfetti: false}), 4000);
@@ -485,11 +531,9 @@ export class TaskSidebar extends React.Component<TaskSidebarProps> {
             const userId = this.getUserId();
             if (!userId) return;
             try {
-                const tasksInGroup = this.state.tasks.filter(t => t.group_id === groupId);
-                for (const task of tasksInGroup) {
-                    await fetch(`${baseUrl}/tasks?user_id=${userId}&id=${task.id}`, {method: 'DELETE', credentials: 'same-origin'});
-                }
-                await fetch(`${baseUrl}/groups?user_id=${userId}&id=${groupId}`, {method: 'DELETE', credentials: 'same-origin'});
+                await fetch(`${baseUrl}/tasks/bulk?user_id=${userId}`, {
+                    method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({operations: [{op: 'delete_group', group_id: groupId}]}), credentials: 'same-origin'
+                });
                 this.setState({deleteGroupWarningShown: false, groupToDelete: null});
                 this.loadTasks();
             } catch (e) {
@@ -499,11 +543,9 @@ export class TaskSidebar extends React.Component<TaskSidebarProps> {
             const channelId = this.getChannelId();
             if (!channelId) return;
             try {
-                const tasksInGroup = this.state.tasks.filter(t => t.group_id === groupId);
-                for (const task of tasksInGroup) {
-                    await fetch(`${baseUrl}/tasks?channel_id=${channelId}&id=${task.id}`, {method: 'DELETE', credentials: 'same-origin'});
-                }
-                await fetch(`${baseUrl}/groups?channel_id=${channelId}&id=${groupId}`, {method: 'DELETE', credentials: 'same-origin'});
+                await fetch(`${baseUrl}/tasks/bulk?channel_id=${channelId}`, {
+                    method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({operations: [{op: 'delete_group', group_id: groupId}]}), credentials: 'same-origin'
+                });
                 this.setState({deleteGroupWarningShown: false, groupToDelete: null});
                 this.loadTasks();
             } catch (e) {
@@ -570,10 +612,9 @@ export class TaskSidebar extends React.Component<TaskSidebarProps> {
             const userId = this.getUserId();
             if (!userId) return;
             try {
-                const completedTasks = this.getCompletedTasks();
-                for (const task of completedTasks) {
-                    await fetch(`${baseUrl}/tasks?user_id=${userId}&id=${task.id}`, {method: 'DELETE', credentials: 'same-origin'});
-                }
+                await fetch(`${baseUrl}/tasks/bulk?user_id=${userId}`, {
+                    method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({operations: [{op: 'delete_completed'}]}), credentials: 'same-origin'
+                });
                 this.setState({deleteCompletedWarningShown: false});
                 this.loadTasks();
             } catch (e) {
@@ -583,10 +624,9 @@ export class TaskSidebar extends React.Component<TaskSidebarProps> {
             const channelId = this.getChannelId();
             if (!channelId) return;
             try {
-                const completedTasks = this.getCompletedTasks();
-                for (const task of completedTasks) {
-                    await fetch(`${baseUrl}/tasks?channel_id=${channelId}&id=${task.id}`, {method: 'DELETE', credentials: 'same-origin'});
-                }
+                await fetch(`${baseUrl}/tasks/bulk?channel_id=${channelId}`, {
+                    method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({operations: [{op: 'delete_completed'}]}), credentials: 'same-origin'
+                });
                 this.setState({deleteCompletedWarningShown: false});
                 this.loadTasks();
             } catch (e) {
@@ -4,6 +4,9 @@ import {adjustOpacity} from "./utils";
 
 const PRIVATE_MODE_STORAGE_KEY = 'mattermost-task-private-mode';
 
+// The events the server publishes after every change to a task list, see server/events.go.
+const LIST_EVENTS = ['task_created', 'task_updated', 'task_deleted', 'group_created', 'group_updated', 'group_deleted'];
+
 export default class Plugin {
     private store: any = null;
     private toggleRHSPlugin: any = null;
@@ -11,7 +14,9 @@ export default class Plugin {
     private unsubscribeStore: (() => void) | null = null;
     private lastChannelId: string | null = null;
     private showPrivate: boolean = false;
+    private privateTasksEnabled: boolean = true;
     private forceUpdateCallbacks: Array<() => void> = [];
+    private listEventCallbacks: Array<(event: string, data: any) => void> = [];
 
     public initialize(registry: any, store: any) {
         this.store = store;
@@ -37,6 +42,7 @@ export default class Plugin {
         });
 
         this.reportActivity();
+        this.loadConfig();
 
         const pluginInstance = this;
 
@@ -53,6 +59,7 @@ export default class Plugin {
         const DynamicTitle = () => {
             const [title, setTitle] = React.useState(pluginInstance.showPrivate ? 'Private Tasks' : 'Channel Tasks');
             const [showPrivate, setShowPrivate] = React.useState(pluginInstance.showPrivate);
+            const [privateTasksEnabled, setPrivateTasksEnabled] = React.useState(pluginInstance.privateTasksEnabled);
 
             const centerChannelBg = '#ffffff';
             const centerChannelColor = '#333333';
@@ -61,7 +68,10 @@ export default class Plugin {
 
             // Subscribe to private mode changes
             React.useEffect(() => {
-                const callback = () => setShowPrivate(pluginInstance.showPrivate);
+                const callback = () => {
+                    setShowPrivate(pluginInstance.showPrivate);
+                    setPrivateTasksEnabled(pluginInstance.privateTasksEnabled);
+                };
                 pluginInstance.forceUpdateCallbacks.push(callback);
                 return () => {
                     pluginInstance.forceUpdateCallbacks = pluginInstance.forceUpdateCallbacks.filter(cb => cb !== callback);
@@ -139,7 +149,7 @@ export default class Plugin {
             return (
                 <div id="header" style={{position: 'relative', width: '100%'}}>
                     <span style={{overflow: 'hidden', maxWidth: 'calc(100% - 2em)', display: 'block', textOverflow: 'ellipsis'}}>{title}</span>
-                    <div style={{position: 'absolute', top: '50%', right: '-1rem', height: '32px', padding: '0px 4px', borderRadius: 'var(--radius-s)', display: 'flex', alignItems: 'center', gap: '0px', backgroundColor: 'rgb(var(--center-channel-bg-rgb))', color: 'rgba(var(--center-channel-color-rgb), var(--icon-opacity))', cursor: 'pointer', fontSize: '18px', transform: 'translateY(-50%)', transition: 'background-color 0.2s'}}
+                    {privateTasksEnabled && <div style={{position: 'absolute', top: '50%', right: '-1rem', height: '32px', padding: '0px 4px', borderRadius: 'var(--radius-s)', display: 'flex', alignItems: 'center', gap: '0px', backgroundColor: 'rgb(var(--center-channel-bg-rgb))', color: 'rgba(var(--center-channel-color-rgb), var(--icon-opacity))', cursor: 'pointer', fontSize: '18px', transform: 'translateY(-50%)', transition: 'background-color 0.2s'}}
                          onClick={handleTogglePrivate}
                          title={showPrivate ? 'Switch to Channel Tasks' : 'Switch to Private Tasks'}
                          onMouseEnter={(e) => { e.currentTarget.style.backgroundColor = 'rgba(var(--center-channel-color-rgb), 0.08)'; }}
@@ -147,7 +157,7 @@ export default class Plugin {
                         <i className="icon icon-arrow-right"></i>
                         {showPrivate ? <i className={"icon icon-product-channels"} style={{width: '1em'}}></i>
                             : <i className={"icon icon-account-outline"} style={{width: '1em'}}></i>}
-                    </div>
+                    </div>}
                     <style>{`
                         #header .icon:before {
                             margin: 0!important;
@@ -175,7 +185,14 @@ export default class Plugin {
                 pluginInstance.channelChangeCallbacks.push(callback);
             };
 
-            return <TaskSidebar {...props} onChannelChange={onChannelChange} privateTasks={privateMode}/>;
+            const onListEvent = (callback: (event: string, data: any) => void) => {
+                pluginInstance.listEventCallbacks.push(callback);
+                return () => {
+                    pluginInstance.listEventCallbacks = pluginInstance.listEventCallbacks.filter(cb => cb !== callback);
+                };
+            };
+
+            return <TaskSidebar {...props} onChannelChange={onChannelChange} onListEvent={onListEvent} privateTasks={privateMode}/>;
         };
 
         const {toggleRHSPlugin} = registry.registerRightHandSidebarComponent(TaskSidebarWrapper, DynamicTitle);
@@ -197,8 +214,64 @@ export default class Plugin {
             },
             () => <i className="icon icon-check"/>
         );
+
+        LIST_EVENTS.forEach(event => {
+            registry.registerWebSocketEventHandler(`custom_com.mattermost.channel-task_${event}`, (msg: any) => {
+                pluginInstance.listEventCallbacks.forEach(callback => callback(event, msg.data));
+            });
+        });
+
+        registry.registerPostDropdownMenuAction(
+            'Create task',
+            (postId: string) => {
+                pluginInstance.createTaskFromPost(postId);
+            }
+        );
     }
 
+    private createTaskFromPost = async (postId: string) => {
+        const state = this.store.getState();
+        const teamId = state?.entities?.teams?.currentTeamId;
+        try {
+            const response = await fetch('/plugins/com.mattermost.channel-task/api/v1/tasks/from-post', {
+                method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify({post_id: postId, team_id: teamId}), credentials: 'same-origin'
+            });
+            if (!response.ok) {
+                console.error('Error creating task from post:', response.status);
+                return;
+            }
+            // Show the channel list, where the new task now appears
+            if (this.showPrivate) {
+                this.showPrivate = false;
+                try {
+                    localStorage.setItem(PRIVATE_MODE_STORAGE_KEY, 'false');
+                } catch (e) {
+                    console.error('Error saving private mode preference:', e);
+                }
+                this.forceUpdateCallbacks.forEach(cb => cb());
+            }
+            this.channelChangeCallbacks.forEach(callback => callback());
+        } catch (error) {
+            console.error('Error creating task from post:', error);
+        }
+    };
+
+    // Hides the private task list when private tasks are disabled in the System Console.
+    private loadConfig = async () => {
+        try {
+            const response = await fetch('/plugins/com.mattermost.channel-task/api/v1/config');
+            if (!response.ok) return;
+            const config = await response.json();
+            this.privateTasksEnabled = config.private_tasks_enabled !== false;
+            if (!this.privateTasksEnabled) {
+                this.showPrivate = false;
+            }
+            this.forceUpdateCallbacks.forEach(cb => cb());
+        } catch (error) {
+            console.error('Error loading plugin configuration:', error);
+        }
+    };
+
     private reportActivity = async () => {
         try {
             await fetch('/plugins/com.mattermost.channel-task/api/v1/activity', {method: 'POST'});
@@ -210,6 +283,7 @@ export default class Plugin {
     public uninitialize() {
         if (this.unsubscribeStore) this.unsubscribeStore();
         this.channelChangeCallbacks = [];
+        this.listEventCallbacks = [];
     }
 }
 
@@ -1,19 +1,29 @@
 export interface TaskItem {
     id: string;
+    number?: number;
     text: string;
     notes?: string;
     completed: boolean;
     assignee_ids?: string[];
     group_id?: string;
     created_at: string;
+    created_by?: string;
     completed_at?: string;
     deadline?: string;
+    priority?: 'P0' | 'P1' | 'P2' | 'P3';
+    version?: number;
+    updated_at?: string;
+    source_post_id?: string;
+    permalink?: string;
+    thread_id?: string;
+    last_activity_at?: string;
 }
 
 export interface TaskGroup {
     id: string;
     name: string;
     order?: string;
+    version?: number;
 }
 
 export interface ChannelTaskList {